@@ -5,7 +5,9 @@ import (
 	"github.com/baisalov/metricollector/internal/agent"
 	"github.com/baisalov/metricollector/internal/agent/config"
 	"github.com/baisalov/metricollector/internal/agent/sender"
+	"github.com/baisalov/metricollector/internal/encryption"
 	"github.com/baisalov/metricollector/internal/metric/provider"
+	"github.com/baisalov/metricollector/internal/tlsconfig"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -26,8 +28,36 @@ func main() {
 
 	log.Info("running metric agent", "env", conf)
 
+	httpSender := sender.NewHTTPSender(conf.ReportAddress, conf.HashKey).
+		WithToken(conf.Token).
+		WithKeyID(conf.HashKeyID)
+
+	if conf.HashStrict {
+		httpSender.WithStrictResponse()
+	}
+
+	if conf.CryptoKey != "" {
+		pub, err := encryption.LoadPublicKey(conf.CryptoKey)
+		if err != nil {
+			log.Error("failed to load crypto key", "error", err)
+			os.Exit(1)
+		}
+
+		httpSender.WithPublicKey(pub)
+	}
+
+	if conf.TLSCA != "" || conf.TLSCert != "" || conf.TLSKey != "" {
+		tlsConf, err := tlsconfig.Client(conf.TLSCA, conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			log.Error("failed to configure tls", "error", err)
+			os.Exit(1)
+		}
+
+		httpSender.WithTLS(tlsConf)
+	}
+
 	metricAgent := agent.NewMetricAgent(
-		sender.NewHTTPSender(conf.ReportAddress, conf.HashKey),
+		httpSender,
 		conf.ReteLimit,
 		provider.MemStats{}, provider.Custom{}, provider.Gopsutil{})
 
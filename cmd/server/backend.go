@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/closer"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/config"
+	"github.com/baisalov/metricollector/internal/server/service"
+	"github.com/baisalov/metricollector/internal/server/storage/bolt"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/baisalov/metricollector/internal/server/storage/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.etcd.io/bbolt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+type backendStorage interface {
+	service.MetricStorage
+	Each(ctx context.Context, fn func(metric.Metric) error) error
+}
+
+type transactionManager interface {
+	Do(context.Context, func(context.Context) error) error
+}
+
+type tokenStore interface {
+	Create(ctx context.Context, t auth.Token) error
+	List(ctx context.Context) ([]auth.Token, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// backend is the storage selected by the config, for the commands that
+// work with data outside of the running server.
+type backend struct {
+	storage backendStorage
+	tm      transactionManager
+	tokens  tokenStore
+}
+
+// openBackend opens the storage selected by conf the same way the server
+// does. The memory storage is always restored from its file and written
+// back on every change. With readOnly, which only affects the memory
+// storage, its file is neither created nor written, so commands that do
+// not change metrics can not clobber what a running server archives.
+func openBackend(ctx context.Context, conf config.Config, closings *closer.Closer, readOnly bool) (backend, error) {
+	if conf.DatabaseDsn != "" {
+		pool, err := pgxpool.New(ctx, conf.DatabaseDsn)
+		if err != nil {
+			return backend{}, fmt.Errorf("failed to connect to database: %w", err)
+		}
+
+		db := stdlib.OpenDBFromPool(pool)
+		closings.Register("closing database connection", db)
+
+		storage, err := postgres.NewMetricStorage(db)
+		if err != nil {
+			return backend{}, fmt.Errorf("failed to init database storage: %w", err)
+		}
+
+		return backend{storage, postgres.NewTransactionManager(db), postgres.NewTokenStore(db)}, nil
+	}
+
+	if conf.BoltPath != "" {
+		db, err := bbolt.Open(conf.BoltPath, 0600, &bbolt.Options{Timeout: time.Second})
+		if err != nil {
+			return backend{}, fmt.Errorf("failed to open bolt database: %w", err)
+		}
+
+		closings.Register("closing bolt database", db)
+
+		storage, err := bolt.NewMetricStorage(db)
+		if err != nil {
+			return backend{}, fmt.Errorf("failed to init bolt storage: %w", err)
+		}
+
+		tokens, err := bolt.NewTokenStore(db)
+		if err != nil {
+			return backend{}, fmt.Errorf("failed to init bolt token store: %w", err)
+		}
+
+		return backend{storage, bolt.NewTransactionManager(db), tokens}, nil
+	}
+
+	flags := os.O_RDWR | os.O_CREATE | os.O_SYNC
+	if readOnly {
+		flags = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(conf.StoragePath, flags, 0666)
+	if readOnly && errors.Is(err, fs.ErrNotExist) {
+		// nothing was archived yet, the storage is empty
+		file, err = os.Open(os.DevNull)
+	}
+
+	if err != nil {
+		return backend{}, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	closings.Register("closing file", file)
+
+	storage, err := memory.NewMetricStorage(file, 0, true)
+	if err != nil {
+		return backend{}, fmt.Errorf("failed to init storage: %w", err)
+	}
+
+	// closing the storage archives it back into the file
+	if !readOnly {
+		closings.Register("closing metric storage", storage)
+	}
+
+	tokens, err := memory.NewTokenStore(tokensPath(conf))
+	if err != nil {
+		return backend{}, fmt.Errorf("failed to init token store: %w", err)
+	}
+
+	return backend{storage, memory.NewTransactionManager(storage), tokens}, nil
+}
+
+// tokensPath is where the memory backend keeps API tokens, next to the
+// metrics file.
+func tokensPath(conf config.Config) string {
+	return conf.StoragePath + ".tokens"
+}
@@ -2,30 +2,63 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"github.com/baisalov/metricollector/internal/checker"
 	"github.com/baisalov/metricollector/internal/closer"
+	"github.com/baisalov/metricollector/internal/encryption"
+	"github.com/baisalov/metricollector/internal/server/broker"
 	"github.com/baisalov/metricollector/internal/server/config"
 	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
 	"github.com/baisalov/metricollector/internal/server/handler/http/v1"
+	"github.com/baisalov/metricollector/internal/server/handler/http/v2"
+	"github.com/baisalov/metricollector/internal/server/ratelimit"
 	"github.com/baisalov/metricollector/internal/server/service"
+	"github.com/baisalov/metricollector/internal/server/storage/bolt"
 	"github.com/baisalov/metricollector/internal/server/storage/memory"
 	"github.com/baisalov/metricollector/internal/server/storage/postgres"
-	"github.com/baisalov/metricollector/internal/transactions"
+	"github.com/baisalov/metricollector/internal/tlsconfig"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
+	"go.etcd.io/bbolt"
 	"golang.org/x/sync/errgroup"
 	"log"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
+const usage = `usage: server [flags] [command]
+
+Without a command the server is started. Commands:
+  migrate           apply the database migrations
+  export [file]     write a snapshot of the metrics, to stdout by default
+  import [-merge] [file]
+                    load a snapshot, from stdin by default
+  token create|list|revoke
+                    manage API tokens
+
+Export and import work on the storage directly, so stop the server
+first: with the memory storage a running server does not see imported
+metrics and overwrites them, and an export misses what it has not
+archived yet.
+
+Flags:
+`
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 
 	conf := config.MustLoad()
 
@@ -36,6 +69,32 @@ func main() {
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, logOpt))
 	slog.SetDefault(logger)
 
+	if args := flag.Args(); len(args) > 0 {
+		// stdout may carry command output such as an exported snapshot
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, logOpt)))
+
+		var err error
+
+		switch args[0] {
+		case "migrate":
+			err = migrate(context.Background(), conf, args[1:])
+		case "export":
+			err = exportSnapshot(context.Background(), conf, args[1:])
+		case "import":
+			err = importSnapshot(context.Background(), conf, args[1:])
+		case "token":
+			err = token(context.Background(), conf, args[1:])
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+
+		if err != nil {
+			log.Fatalf("%s: %v\n", args[0], err)
+		}
+
+		return
+	}
+
 	logger.Info("running metric server", "env", conf)
 
 	closings := closer.NewCloser()
@@ -49,12 +108,71 @@ func main() {
 
 	router := chi.NewMux()
 
-	router.Use(middleware.GzipCompress, middleware.GzipDecompress)
+	router.Use(middleware.GzipCompress)
+
+	if conf.MaxBodySize > 0 {
+		router.Use(middleware.LimitBody(conf.MaxBodySize))
+	}
+
+	if conf.CryptoKey != "" {
+		key, err := encryption.LoadPrivateKey(conf.CryptoKey)
+		if err != nil {
+			log.Fatalf("failed to load crypto key: %v\n", err)
+		}
+
+		router.Use(middleware.Decrypt(key))
+	}
+
+	router.Use(middleware.GzipDecompress)
+
+	if conf.MaxBodySize > 0 {
+		router.Use(middleware.LimitBody(conf.MaxBodySize))
+	}
+
+	keys := middleware.Keys{}
+	maps.Copy(keys, conf.HashKeys)
 
 	if conf.HashKey != "" {
-		router.Use(middleware.HashCheck(conf.HashKey))
+		keys[""] = conf.HashKey
 	}
 
+	if len(keys) > 0 {
+		router.Use(middleware.SignResponse(keys))
+
+		if conf.HashStrict {
+			router.Use(middleware.VerifySignature(keys))
+		} else {
+			router.Use(middleware.HashCheck(keys))
+		}
+	}
+
+	if len(conf.TrustedSubnets) > 0 {
+		subnets := make([]netip.Prefix, 0, len(conf.TrustedSubnets))
+
+		for _, cidr := range conf.TrustedSubnets {
+			subnet, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+			if err != nil {
+				log.Fatalf("failed to parse trusted subnet: %v\n", err)
+			}
+
+			subnets = append(subnets, subnet.Masked())
+		}
+
+		router.Use(middleware.TrustedSubnets(subnets))
+	}
+
+	// the limiter keys clients by their token, so it is installed after
+	// Authenticate below; the body limits bound the work done before it
+	var rateLimit func(http.Handler) http.Handler
+
+	if conf.RateLimit > 0 {
+		rateLimit = middleware.RateLimit(ratelimit.NewLimiter(conf.RateLimit, conf.RateBurst))
+	}
+
+	idempotencyTTL := time.Duration(conf.IdempotencyTTL) * time.Second
+
+	updates := broker.NewBroker()
+
 	if conf.DatabaseDsn != "" {
 		pool, err := pgxpool.New(context.Background(), conf.DatabaseDsn)
 		if err != nil {
@@ -71,7 +189,70 @@ func main() {
 			log.Fatalf("failed to init database storage: %v\n", err)
 		}
 
-		v1.NewMetricHandler(storage, service.NewMetricUpdateService(storage, postgres.NewTransactionManager(db))).Register(router)
+		tokens := postgres.NewTokenStore(db)
+
+		if conf.Auth {
+			router.Use(middleware.Authenticate(tokens))
+		}
+
+		if rateLimit != nil {
+			router.Use(rateLimit)
+		}
+
+		router.Use(middleware.Idempotency(postgres.NewIdempotencyStore(db, idempotencyTTL)))
+
+		updater := service.NewMetricUpdateService(storage, postgres.NewTransactionManager(db)).WithPublisher(updates)
+
+		v1.NewMetricHandler(storage, updater).WithMaxBatch(conf.MaxBatch).Register(router)
+		v2.NewMetricHandler(storage, updater).WithMaxBatch(conf.MaxBatch).Register(router)
+		v2.NewExportHandler(storage).Register(router)
+		v1.NewDashboardHandler(storage).Register(router)
+
+		// without auth every route is open, and an open token route
+		// would hand out admin tokens to anyone
+		if conf.Auth {
+			v1.NewTokenHandler(tokens).Register(router)
+		}
+	} else if conf.BoltPath != "" {
+		db, err := bbolt.Open(conf.BoltPath, 0600, &bbolt.Options{Timeout: time.Second})
+		if err != nil {
+			log.Fatalf("failed to open bolt database: %v\n", err)
+		}
+
+		closings.Register("closing bolt database", db)
+
+		storage, err := bolt.NewMetricStorage(db)
+		if err != nil {
+			log.Fatalf("failed to init bolt storage: %v\n", err)
+		}
+
+		tokens, err := bolt.NewTokenStore(db)
+		if err != nil {
+			log.Fatalf("failed to init bolt token store: %v\n", err)
+		}
+
+		if conf.Auth {
+			router.Use(middleware.Authenticate(tokens))
+		}
+
+		if rateLimit != nil {
+			router.Use(rateLimit)
+		}
+
+		router.Use(middleware.Idempotency(memory.NewIdempotencyStore(idempotencyTTL)))
+
+		updater := service.NewMetricUpdateService(storage, bolt.NewTransactionManager(db)).WithPublisher(updates)
+
+		v1.NewMetricHandler(storage, updater).WithMaxBatch(conf.MaxBatch).Register(router)
+		v2.NewMetricHandler(storage, updater).WithMaxBatch(conf.MaxBatch).Register(router)
+		v2.NewExportHandler(storage).Register(router)
+		v1.NewDashboardHandler(storage).Register(router)
+
+		// the backup hands out the whole database, tokens included
+		if conf.Auth {
+			v1.NewTokenHandler(tokens).Register(router)
+			v1.NewAdminHandler(storage).Register(router)
+		}
 	} else {
 		slog.Info("creating file")
 		file, err := os.OpenFile(conf.StoragePath, os.O_RDWR|os.O_CREATE|os.O_SYNC, 0666)
@@ -89,10 +270,36 @@ func main() {
 
 		closings.Register("closing metric storage", storage)
 
-		v1.NewMetricHandler(storage, service.NewMetricUpdateService(storage, transactions.DiscardManager{})).Register(router)
+		tokens, err := memory.NewTokenStore(tokensPath(conf))
+		if err != nil {
+			log.Fatalf("failed to init token store: %v\n", err)
+		}
+
+		if conf.Auth {
+			router.Use(middleware.Authenticate(tokens))
+		}
+
+		if rateLimit != nil {
+			router.Use(rateLimit)
+		}
+
+		router.Use(middleware.Idempotency(memory.NewIdempotencyStore(idempotencyTTL)))
+
+		updater := service.NewMetricUpdateService(storage, memory.NewTransactionManager(storage)).WithPublisher(updates)
+
+		v1.NewMetricHandler(storage, updater).WithMaxBatch(conf.MaxBatch).Register(router)
+		v2.NewMetricHandler(storage, updater).WithMaxBatch(conf.MaxBatch).Register(router)
+		v2.NewExportHandler(storage).Register(router)
+		v1.NewDashboardHandler(storage).Register(router)
+
+		if conf.Auth {
+			v1.NewTokenHandler(tokens).Register(router)
+		}
 	}
 
+	v2.NewStreamHandler(updates).Register(router)
 	v1.NewHealthCheckHandler(check).Register(router)
+	v1.NewOpenAPIHandler().Register(router)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -109,11 +316,27 @@ func main() {
 		},
 	}
 
+	// any TLS setting asks for TLS, so a partial one fails instead of
+	// silently serving plain HTTP
+	if conf.TLSCert != "" || conf.TLSKey != "" || conf.TLSClientCA != "" {
+		tlsConf, err := tlsconfig.Server(conf.TLSCert, conf.TLSKey, conf.TLSClientCA)
+		if err != nil {
+			log.Fatalf("failed to configure tls: %v\n", err)
+		}
+
+		httpServer.TLSConfig = tlsConf
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 
-	slog.Info("running server")
+	slog.Info("running server", "tls", httpServer.TLSConfig != nil)
 
 	g.Go(func() error {
+		if httpServer.TLSConfig != nil {
+			// the certificate is already in TLSConfig
+			return httpServer.ListenAndServeTLS("", "")
+		}
+
 		return httpServer.ListenAndServe()
 	})
 
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/server/config"
+	"github.com/baisalov/metricollector/internal/server/storage/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"log/slog"
+	"strconv"
+)
+
+// migrate runs `server -d <dsn> migrate [up | down [steps] | version]`.
+func migrate(ctx context.Context, conf config.Config, args []string) (err error) {
+	if conf.DatabaseDsn == "" {
+		return errors.New("database dsn is required")
+	}
+
+	pool, err := pgxpool.New(ctx, conf.DatabaseDsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	db := stdlib.OpenDBFromPool(pool)
+
+	defer func() {
+		if r := db.Close(); r != nil {
+			err = errors.Join(err, r)
+		}
+	}()
+
+	m, err := postgres.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		err = m.Up(ctx)
+	case "down":
+		steps := 1
+
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("incorrect steps count %q", args[1])
+			}
+		}
+
+		err = m.Down(ctx, steps)
+	case "version":
+	default:
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("database schema", "version", version)
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/closer"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/config"
+	"github.com/baisalov/metricollector/internal/server/service"
+	"github.com/baisalov/metricollector/internal/server/snapshot"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// exportSnapshot runs `server export [file]`, writing to stdout by default.
+func exportSnapshot(ctx context.Context, conf config.Config, args []string) (err error) {
+	closings := closer.NewCloser()
+
+	defer func() {
+		err = errors.Join(err, closings.Close())
+	}()
+
+	b, err := openBackend(ctx, conf, closings, true)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot file: %w", err)
+		}
+
+		closings.Register("closing snapshot file", file)
+
+		w = file
+	}
+
+	n, err := snapshot.Write(ctx, w, b.storage)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	slog.Info("snapshot exported", "metrics", n)
+
+	return nil
+}
+
+var (
+	errNotEmpty      = errors.New("storage is not empty, use -merge to import into it")
+	errServerRunning = errors.New("a server is running on the address, stop it first or it will overwrite the import when it archives its metrics")
+)
+
+// importSnapshot runs `server import [-merge] [file]`, reading stdin by
+// default. Without -merge the storage must be empty. With it, counter
+// totals from the snapshot are added to the stored ones and gauges are
+// overwritten.
+func importSnapshot(ctx context.Context, conf config.Config, args []string) (err error) {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	merge := fs.Bool("merge", false, "merge into existing metrics")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: server import [-merge] [file]")
+		fs.PrintDefaults()
+	}
+
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+
+	// the memory storage lives in the server process, which archives it
+	// over the file the import writes to
+	if conf.DatabaseDsn == "" && conf.BoltPath == "" && listening(conf.Address) {
+		return errServerRunning
+	}
+
+	var r io.Reader = os.Stdin
+
+	if path := fs.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open snapshot file: %w", err)
+		}
+
+		defer file.Close()
+
+		r = file
+	}
+
+	header, metrics, err := snapshot.Read(r)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	closings := closer.NewCloser()
+
+	defer func() {
+		err = errors.Join(err, closings.Close())
+	}()
+
+	b, err := openBackend(ctx, conf, closings, false)
+	if err != nil {
+		return err
+	}
+
+	if !*merge {
+		err = b.storage.Each(ctx, func(metric.Metric) error {
+			return errNotEmpty
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// on an empty storage adding counter totals is the same as setting them
+	if err = service.NewMetricUpdateService(b.storage, b.tm).Updates(ctx, metrics...); err != nil {
+		return fmt.Errorf("failed to import metrics: %w", err)
+	}
+
+	slog.Info("snapshot imported", "metrics", len(metrics), "created", header.Created, "merge", *merge)
+
+	return nil
+}
+
+// listening reports whether something accepts connections on address,
+// which for the configured server address means the server is running.
+func listening(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+
+	return true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/closer"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/config"
+	"os"
+)
+
+// token runs `server token create -name <name> -scopes <scopes>`,
+// `server token list` and `server token revoke <id>`. create is the way
+// to get the first admin token; it prints the secret once.
+func token(ctx context.Context, conf config.Config, args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("token action is required: create, list or revoke")
+	}
+
+	closings := closer.NewCloser()
+
+	defer func() {
+		err = errors.Join(err, closings.Close())
+	}()
+
+	action, args := args[0], args[1:]
+
+	var run func(ctx context.Context, tokens tokenStore, args []string) error
+
+	switch action {
+	case "create":
+		run = createToken
+	case "list":
+		run = listTokens
+	case "revoke":
+		run = revokeToken
+	default:
+		return fmt.Errorf("unknown token action %q", action)
+	}
+
+	b, err := openBackend(ctx, conf, closings, true)
+	if err != nil {
+		return err
+	}
+
+	return run(ctx, b.tokens, args)
+}
+
+func createToken(ctx context.Context, tokens tokenStore, args []string) error {
+	fs := flag.NewFlagSet("token create", flag.ContinueOnError)
+	name := fs.String("name", "", "token description")
+	scopes := fs.String("scopes", string(auth.ScopeWrite), "comma separated scopes: read, write, admin")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	parsed, err := auth.ParseScopes(*scopes)
+	if err != nil {
+		return err
+	}
+
+	t, secret, err := auth.Issue(*name, parsed)
+	if err != nil {
+		return err
+	}
+
+	if err = tokens.Create(ctx, t); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(os.Stdout, "%s\t%s\n", t.ID, secret)
+
+	return err
+}
+
+func listTokens(ctx context.Context, tokens tokenStore, _ []string) error {
+	list, err := tokens.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+
+	for _, t := range list {
+		if err = encoder.Encode(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func revokeToken(ctx context.Context, tokens tokenStore, args []string) error {
+	if len(args) != 1 {
+		return errors.New("token id is required")
+	}
+
+	return tokens.Revoke(ctx, args[0])
+}
@@ -2,12 +2,13 @@ package agent
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/baisalov/metricollector/internal/metric"
 	"golang.org/x/sync/errgroup"
 	"log/slog"
-	"maps"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +18,11 @@ type MetricAgent struct {
 	mx    sync.RWMutex
 	run   *atomic.Bool
 	state map[string]metric.Metric
+	// unacked holds the counter deltas sent but not acknowledged yet by
+	// id. They are resent with the same key and payload until they are,
+	// because the server may have applied them although sending failed.
+	unacked map[string]*delivery
+	backoff *backoff
 
 	providers   []metricProvider
 	sender      metricSender
@@ -24,7 +30,21 @@ type MetricAgent struct {
 }
 
 type metricSender interface {
-	Send(ctx context.Context, metrics ...metric.Metric) error
+	Send(ctx context.Context, key string, metrics ...metric.Metric) error
+}
+
+// delivery is a metric with the idempotency key it is sent under.
+type delivery struct {
+	key    string
+	metric metric.Metric
+	// sending is set while the delivery is handed to a reporter.
+	sending bool
+}
+
+// retryAfterer is implemented by send errors of a server that asked to
+// be retried later.
+type retryAfterer interface {
+	RetryAfter() time.Duration
 }
 
 type metricProvider interface {
@@ -37,6 +57,8 @@ func NewMetricAgent(sender metricSender, senderCount int, providers ...metricPro
 		mx:          sync.RWMutex{},
 		run:         &atomic.Bool{},
 		state:       make(map[string]metric.Metric),
+		unacked:     make(map[string]*delivery),
+		backoff:     newBackoff(),
 		providers:   providers,
 		sender:      sender,
 		senderCount: senderCount,
@@ -59,7 +81,7 @@ func (a *MetricAgent) Run(ctx context.Context, pullInterval, reportInterval time
 	reportTicker := time.NewTicker(reportInterval)
 	defer reportTicker.Stop()
 
-	ch := make(chan metric.Metric)
+	ch := make(chan delivery)
 	defer close(ch)
 
 	for i := 0; i < a.senderCount; i++ {
@@ -115,46 +137,170 @@ func (a *MetricAgent) puller(ctx context.Context, ticker *time.Ticker, provider
 	}
 }
 
-func (a *MetricAgent) report(ctx context.Context, ch chan metric.Metric) {
-	a.mx.RLock()
-
-	localStat := make(map[string]metric.Metric, len(a.state))
-	maps.Copy(localStat, a.state)
+func (a *MetricAgent) report(ctx context.Context, ch chan delivery) {
+	if wait := a.backoff.remaining(); wait > 0 {
+		slog.Info("sending postponed", "wait", wait)
+		return
+	}
 
-	a.mx.RUnlock()
+	deliveries, err := a.collect()
+	if err != nil {
+		slog.Error("failed to collect metrics", "error", err)
+	}
 
-	for _, m := range localStat {
+	for i, d := range deliveries {
 		select {
 		case <-ctx.Done():
+			// the counter deltas are not lost if the agent is run again
+			for _, d := range deliveries[i:] {
+				a.release(d)
+			}
+
 			return
-		case ch <- m:
+		case ch <- d:
 		}
 	}
 }
 
-func (a *MetricAgent) reporter(ctx context.Context, sender metricSender, ch chan metric.Metric) func() error {
+func (a *MetricAgent) reporter(ctx context.Context, sender metricSender, ch chan delivery) func() error {
 	return func() error {
 		for {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case m := <-ch:
-				err := sender.Send(ctx, m)
+			case d := <-ch:
+				if a.backoff.remaining() > 0 {
+					a.release(d)
+					continue
+				}
+
+				err := a.deliver(ctx, sender, d)
 				if err != nil {
-					slog.Error("failed to report metric", "error", err)
-					// return fmt.Errorf("failed to report metric: %w", err)
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+
+					var retryAfter time.Duration
+
+					var ra retryAfterer
+					if errors.As(err, &ra) {
+						retryAfter = ra.RetryAfter()
+					}
+
+					slog.Error("failed to report metric", "error", err, "backoff", a.backoff.fail(retryAfter))
+
+					continue
 				}
+
+				a.backoff.succeed()
 			}
 
 		}
 	}
 }
 
+// collect takes the metrics to report. Gauges are sent with their
+// latest value. Counter deltas are taken out of the state into a new
+// delivery, unless the previous delivery of the counter is still not
+// acknowledged: that one is resent as is and the new deltas keep adding
+// up in the state until it is.
+func (a *MetricAgent) collect() ([]delivery, error) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	deliveries := make([]delivery, 0, len(a.state)+len(a.unacked))
+
+	for _, d := range a.unacked {
+		if !d.sending {
+			d.sending = true
+			deliveries = append(deliveries, *d)
+		}
+	}
+
+	for id, m := range a.state {
+		if _, ok := a.unacked[id]; ok && m.MType == metric.Counter {
+			continue
+		}
+
+		key, err := idempotencyKey()
+		if err != nil {
+			return deliveries, fmt.Errorf("failed to generate idempotency key: %w", err)
+		}
+
+		d := delivery{key: key, metric: m, sending: true}
+
+		if m.MType == metric.Counter {
+			a.unacked[id] = &d
+			delete(a.state, id)
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// deliver sends d and keeps track of whether the server acknowledged it.
+func (a *MetricAgent) deliver(ctx context.Context, sender metricSender, d delivery) error {
+	if err := sender.Send(ctx, d.key, d.metric); err != nil {
+		a.release(d)
+		return err
+	}
+
+	a.ack(d)
+
+	return nil
+}
+
+// release makes a delivery that was not acknowledged due for the next
+// report.
+func (a *MetricAgent) release(d delivery) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if u, ok := a.unacked[d.metric.ID]; ok && u.key == d.key {
+		u.sending = false
+	}
+}
+
+// ack forgets a delivery the server acknowledged.
+func (a *MetricAgent) ack(d delivery) {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if u, ok := a.unacked[d.metric.ID]; ok && u.key == d.key {
+		delete(a.unacked, d.metric.ID)
+	}
+}
+
+// idempotencyKey identifies one delivery across all of its attempts, so
+// the server applies it once even when a response is lost.
+func idempotencyKey() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// coalesce merges a newer value of a metric into an older one.
+func coalesce(older, newer metric.Metric) metric.Metric {
+	if older.MType != metric.Counter || newer.MType != metric.Counter || older.Delta == nil || newer.Delta == nil {
+		return newer
+	}
+
+	return metric.NewCounterMetric(newer.ID, *older.Delta+*newer.Delta)
+}
+
+// store keeps the latest value of gauges and adds up counter deltas
+// until they are reported.
 func (a *MetricAgent) store(metrics ...metric.Metric) {
 	a.mx.Lock()
 	defer a.mx.Unlock()
 
 	for _, v := range metrics {
-		a.state[v.ID] = v
+		a.state[v.ID] = coalesce(a.state[v.ID], v)
 	}
 }
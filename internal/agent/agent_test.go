@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type throttled time.Duration
+
+func (e throttled) Error() string {
+	return "throttled"
+}
+
+func (e throttled) RetryAfter() time.Duration {
+	return time.Duration(e)
+}
+
+// result is what senderMock does with one call.
+type result struct {
+	// applied makes the server apply the metrics before err is returned,
+	// like when only the response was lost.
+	applied bool
+	err     error
+}
+
+// senderMock plays the server: a key is applied once, repeated keys are
+// only acknowledged.
+type senderMock struct {
+	mx      sync.Mutex
+	results []result
+	keys    map[string]bool
+	calls   int
+	totals  map[string]int64
+	gauges  map[string]float64
+}
+
+func newSenderMock(results ...result) *senderMock {
+	return &senderMock{
+		results: results,
+		keys:    make(map[string]bool),
+		totals:  make(map[string]int64),
+		gauges:  make(map[string]float64),
+	}
+}
+
+func (s *senderMock) Send(_ context.Context, key string, metrics ...metric.Metric) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.calls++
+
+	res := result{applied: true}
+
+	if len(s.results) > 0 {
+		res = s.results[0]
+		s.results = s.results[1:]
+	}
+
+	if res.applied && !s.keys[key] {
+		s.keys[key] = true
+
+		for _, m := range metrics {
+			if m.MType == metric.Counter {
+				s.totals[m.ID] += *m.Delta
+			} else {
+				s.gauges[m.ID] = *m.Value
+			}
+		}
+	}
+
+	return res.err
+}
+
+type countingProvider struct {
+	loads atomic.Int64
+}
+
+func (p *countingProvider) Source() string {
+	return "counting"
+}
+
+func (p *countingProvider) Load() ([]metric.Metric, error) {
+	p.loads.Add(1)
+	return []metric.Metric{metric.NewCounterMetric("PollCount", 1)}, nil
+}
+
+func collect(t *testing.T, a *MetricAgent) map[string]delivery {
+	t.Helper()
+
+	deliveries, err := a.collect()
+	require.NoError(t, err)
+
+	res := make(map[string]delivery, len(deliveries))
+
+	for _, d := range deliveries {
+		res[d.metric.ID] = d
+	}
+
+	return res
+}
+
+func TestMetricAgent_CounterDeltas(t *testing.T) {
+	sender := newSenderMock()
+
+	a := NewMetricAgent(sender, 1)
+
+	a.store(metric.NewCounterMetric("polls", 1), metric.NewGaugeMetric("load", 1))
+	a.store(metric.NewCounterMetric("polls", 1))
+	a.store(metric.NewCounterMetric("polls", 1), metric.NewGaugeMetric("load", 2))
+
+	got := collect(t, a)
+	require.Contains(t, got, "polls")
+	assert.Equal(t, int64(3), *got["polls"].metric.Delta, "deltas of every poll are reported")
+	assert.Equal(t, 2.0, *got["load"].metric.Value, "the latest gauge is reported")
+
+	again := collect(t, a)
+	assert.NotContains(t, again, "polls", "a delta being sent is not collected again")
+	assert.Contains(t, again, "load", "gauges are reported every time")
+
+	require.NoError(t, a.deliver(context.Background(), sender, got["polls"]))
+
+	assert.NotContains(t, collect(t, a), "polls", "an acknowledged delta is not sent again")
+	assert.Equal(t, int64(3), sender.totals["polls"])
+}
+
+func TestMetricAgent_AppliedButFailed(t *testing.T) {
+	// the server commits the update, but the agent sees an error, e.g. a
+	// timeout or an invalid response signature
+	sender := newSenderMock(result{applied: true, err: errors.New("response lost")})
+
+	a := NewMetricAgent(sender, 1)
+
+	a.store(metric.NewCounterMetric("polls", 2))
+
+	first := collect(t, a)["polls"]
+	require.Error(t, a.deliver(context.Background(), sender, first))
+
+	a.store(metric.NewCounterMetric("polls", 5))
+
+	retry := collect(t, a)
+	require.Contains(t, retry, "polls")
+	assert.Equal(t, first.key, retry["polls"].key, "the delivery is resent with its key")
+	assert.Equal(t, int64(2), *retry["polls"].metric.Delta, "new polls are not merged into it")
+
+	require.NoError(t, a.deliver(context.Background(), sender, retry["polls"]))
+
+	next := collect(t, a)
+	require.Contains(t, next, "polls")
+	assert.NotEqual(t, first.key, next["polls"].key)
+	assert.Equal(t, int64(5), *next["polls"].metric.Delta, "new polls go in a new delivery")
+
+	require.NoError(t, a.deliver(context.Background(), sender, next["polls"]))
+
+	assert.Equal(t, int64(7), sender.totals["polls"], "the server total is exact")
+	assert.Equal(t, 3, sender.calls)
+}
+
+func TestMetricAgent_Run(t *testing.T) {
+	var results []result
+
+	for i := 0; i < 100; i++ {
+		results = append(results,
+			result{applied: true, err: errors.New("response lost")},
+			result{applied: false, err: errors.New("connection refused")},
+			result{applied: true},
+		)
+	}
+
+	sender := newSenderMock(results...)
+	provider := &countingProvider{}
+
+	a := NewMetricAgent(sender, 2, provider)
+	// a thousand times faster clock lets backoffs pass within the test
+	start := time.Now()
+	a.backoff.now = func() time.Time { return start.Add(time.Since(start) * 1000) }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, a.Run(ctx, 10*time.Millisecond, 50*time.Millisecond), context.DeadlineExceeded)
+
+	sender.mx.Lock()
+	require.Greater(t, sender.calls, 3, "failures were retried")
+	sender.results = nil
+	sender.mx.Unlock()
+
+	// deliver what is left once the server is healthy
+	for i := 0; i < 2; i++ {
+		for _, d := range collect(t, a) {
+			_ = a.deliver(context.Background(), sender, d)
+		}
+	}
+
+	assert.Empty(t, a.unacked)
+	assert.Equal(t, provider.loads.Load(), sender.totals["PollCount"], "every poll is counted exactly once")
+}
+
+func TestMetricAgent_Backoff(t *testing.T) {
+	sender := newSenderMock(result{err: errors.Join(errors.New("send"), throttled(time.Minute))})
+
+	a := NewMetricAgent(sender, 1)
+
+	a.store(metric.NewCounterMetric("polls", 3), metric.NewGaugeMetric("load", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan delivery)
+
+	done := make(chan error)
+	go func() { done <- a.reporter(ctx, sender, ch)() }()
+
+	deliveries, err := a.collect()
+	require.NoError(t, err)
+
+	for _, d := range deliveries {
+		ch <- d
+	}
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, 1, sender.calls, "nothing is sent while backing off")
+	assert.InDelta(t, time.Minute, a.backoff.remaining(), float64(time.Second), "retry after is honoured")
+
+	require.Contains(t, a.unacked, "polls")
+	assert.False(t, a.unacked["polls"].sending, "the delta is due for the next report")
+	assert.Equal(t, int64(3), *a.unacked["polls"].metric.Delta)
+
+	t.Run("reports are skipped", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		a.report(ctx, make(chan delivery))
+
+		assert.NoError(t, ctx.Err(), "report did not wait for a reporter")
+	})
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	backoffBase = time.Second
+	backoffMax  = 5 * time.Minute
+)
+
+// backoff is shared by all reporters, so that one failure pauses all of
+// them instead of each hammering the server on its own.
+type backoff struct {
+	mx       sync.Mutex
+	failures int
+	until    time.Time
+
+	now    func() time.Time
+	jitter func() float64
+}
+
+func newBackoff() *backoff {
+	return &backoff{
+		now:    time.Now,
+		jitter: rand.Float64,
+	}
+}
+
+// remaining reports how long sending is still paused.
+func (b *backoff) remaining() time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	return b.until.Sub(b.now())
+}
+
+// fail pauses sending for an exponentially growing, jittered delay, or
+// for retryAfter if the server asked for longer. Failures of requests
+// that were already in flight when the pause began do not grow the delay
+// further, they can only extend it to their retryAfter.
+func (b *backoff) fail(retryAfter time.Duration) time.Duration {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := b.now()
+
+	if now.Before(b.until) {
+		if until := now.Add(retryAfter); until.After(b.until) {
+			b.until = until
+		}
+
+		return b.until.Sub(now)
+	}
+
+	b.failures++
+
+	delay := backoffMax
+	if b.failures < 20 {
+		delay = min(backoffBase<<(b.failures-1), backoffMax)
+	}
+
+	// equal jitter keeps at least half of the delay
+	delay = delay/2 + time.Duration(b.jitter()*float64(delay/2))
+
+	b.until = now.Add(max(delay, retryAfter))
+
+	return b.until.Sub(now)
+}
+
+func (b *backoff) succeed() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures = 0
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	b := newBackoff()
+	b.now = func() time.Time { return now }
+	b.jitter = func() float64 { return 1 }
+
+	assert.LessOrEqual(t, b.remaining(), time.Duration(0))
+
+	assert.Equal(t, backoffBase, b.fail(0))
+	assert.Equal(t, backoffBase, b.remaining())
+
+	t.Run("failures in flight do not grow the delay", func(t *testing.T) {
+		assert.Equal(t, backoffBase, b.fail(0))
+		assert.Equal(t, 3*time.Second, b.fail(3*time.Second), "but retry after extends it")
+	})
+
+	now = now.Add(3 * time.Second)
+
+	assert.Equal(t, 2*backoffBase, b.fail(0), "the delay doubles")
+
+	now = now.Add(2 * time.Second)
+
+	assert.Equal(t, time.Minute, b.fail(time.Minute), "retry after wins over a shorter delay")
+
+	t.Run("capped", func(t *testing.T) {
+		for i := 0; i < 30; i++ {
+			now = now.Add(b.remaining())
+			assert.LessOrEqual(t, b.fail(0), backoffMax)
+		}
+
+		assert.Equal(t, backoffMax, b.remaining())
+	})
+
+	t.Run("jitter keeps half", func(t *testing.T) {
+		b.jitter = func() float64 { return 0 }
+
+		now = now.Add(b.remaining())
+		assert.Equal(t, backoffMax/2, b.fail(0))
+	})
+
+	b.succeed()
+
+	now = now.Add(b.remaining())
+	b.jitter = func() float64 { return 1 }
+
+	assert.Equal(t, backoffBase, b.fail(0), "success starts over")
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"github.com/caarlos0/env/v11"
 	"log"
+	"log/slog"
 )
 
 type Config struct {
@@ -11,7 +12,33 @@ type Config struct {
 	ReportInterval int64  `env:"REPORT_INTERVAL"`
 	ReportAddress  string `env:"ADDRESS"`
 	HashKey        string `env:"KEY"`
+	HashKeyID      string `env:"KEY_ID"`
+	HashStrict     bool   `env:"HASH_STRICT"`
+	CryptoKey      string `env:"CRYPTO_KEY"`
+	TLSCA          string `env:"TLS_CA"`
+	TLSCert        string `env:"TLS_CERT"`
+	TLSKey         string `env:"TLS_KEY"`
 	ReteLimit      int    `env:"RATE_LIMIT"`
+	Token          string `env:"TOKEN"`
+}
+
+// LogValue hides the secrets, so the config can be logged at start.
+func (c Config) LogValue() slog.Value {
+	type plain Config
+
+	p := plain(c)
+	p.HashKey = redact(p.HashKey)
+	p.Token = redact(p.Token)
+
+	return slog.AnyValue(p)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return "[redacted]"
 }
 
 func MustLoad() Config {
@@ -21,7 +48,14 @@ func MustLoad() Config {
 	flag.Int64Var(&conf.ReportInterval, "r", 10, "interval for reporting in seconds")
 	flag.StringVar(&conf.ReportAddress, "a", "localhost:8080", "http address for reporting")
 	flag.StringVar(&conf.HashKey, "k", "", "key for sign body hash")
+	flag.StringVar(&conf.HashKeyID, "key-id", "", "id of the sign key, when the server has several")
+	flag.BoolVar(&conf.HashStrict, "hash-strict", false, "reject unsigned server responses instead of only checking signed ones")
+	flag.StringVar(&conf.CryptoKey, "crypto-key", "", "path to the server public key to encrypt reports with")
+	flag.StringVar(&conf.TLSCA, "tls-ca", "", "path to the CA bundle the server certificate is verified with")
+	flag.StringVar(&conf.TLSCert, "tls-cert", "", "path to the client TLS certificate")
+	flag.StringVar(&conf.TLSKey, "tls-key", "", "path to the client TLS key")
 	flag.IntVar(&conf.ReteLimit, "l", 10, "parallel senders limit")
+	flag.StringVar(&conf.Token, "t", "", "bearer token for the server api")
 
 	flag.Parse()
 
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestConfig_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+
+	conf := Config{ReportAddress: "localhost:8080", HashKey: "secret-key", Token: "mc_secret"}
+
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("running", "env", conf)
+
+	assert.NotContains(t, buf.String(), "secret-key")
+	assert.NotContains(t, buf.String(), "mc_secret")
+	assert.Contains(t, buf.String(), "localhost:8080")
+}
@@ -5,43 +5,122 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/hmac"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/baisalov/metricollector/internal/encryption"
 	"github.com/baisalov/metricollector/internal/metric"
 	"github.com/go-resty/resty/v2"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// ErrInvalidResponseSignature means the response was not signed with the
+// shared key, so it may not come from the real server.
+var ErrInvalidResponseSignature = errors.New("missing or invalid response signature")
+
+// ThrottledError means the server is overloaded or rate limits the agent
+// and asked to come back after RetryAfter, which is zero when it did not
+// say.
+type ThrottledError struct {
+	Status int
+	Wait   time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("server throttled the request with status %d, retry after %s", e.Status, e.Wait)
+}
+
+// RetryAfter is how long the server asked to wait.
+func (e *ThrottledError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
 type HTTPSender struct {
 	address string
 	hashKey string
+	keyID   string
+	token   string
+	pubKey  *rsa.PublicKey
 	client  *resty.Client
+	// implicitScheme is set when the address came without a scheme.
+	implicitScheme bool
+	// strict requires signed responses, otherwise only the signature of
+	// a response that carries one is checked
+	strict bool
 }
 
 func NewHTTPSender(address, hashKey string) *HTTPSender {
-	if !strings.HasPrefix(address, "http://") || !strings.HasPrefix(address, "https://") {
+	implicitScheme := !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://")
+	if implicitScheme {
 		address = "http://" + address
 	}
 
-	client := resty.New()
-
-	client.
-		SetRetryCount(3).
-		SetRetryWaitTime(10 * time.Second).
-		SetRetryMaxWaitTime(30 * time.Second)
+	// failed reports are retried by the agent, which backs off for all
+	// reporters at once and honours Retry-After
+	client := resty.New().SetRetryCount(0)
 
 	return &HTTPSender{
 		address: address,
 		client:  client,
 		hashKey: hashKey,
+
+		implicitScheme: implicitScheme,
 	}
 }
 
-func (s *HTTPSender) Send(ctx context.Context, metrics ...metric.Metric) error {
+// WithToken makes the sender authenticate with a bearer token.
+func (s *HTTPSender) WithToken(token string) *HTTPSender {
+	s.token = token
+	return s
+}
+
+// WithKeyID names the key the sender signs with, so a server holding
+// several keys during a rotation knows which one to check.
+func (s *HTTPSender) WithKeyID(id string) *HTTPSender {
+	s.keyID = id
+	return s
+}
+
+// WithStrictResponse makes the sender reject unsigned responses, not
+// only incorrectly signed ones. It is for servers known to sign all
+// responses, older ones do not.
+func (s *HTTPSender) WithStrictResponse() *HTTPSender {
+	s.strict = true
+	return s
+}
+
+// WithTLS makes the sender use conf for HTTPS connections. An address
+// given without a scheme is switched to https.
+func (s *HTTPSender) WithTLS(conf *tls.Config) *HTTPSender {
+	if s.implicitScheme {
+		s.address = "https://" + strings.TrimPrefix(s.address, "http://")
+	}
+
+	s.client.SetTLSClientConfig(conf)
+
+	return s
+}
+
+// WithPublicKey makes the sender encrypt request bodies for the server
+// holding the private part of key.
+func (s *HTTPSender) WithPublicKey(key *rsa.PublicKey) *HTTPSender {
+	s.pubKey = key
+	return s
+}
+
+// Send posts metrics under the idempotency key, so that a batch resent
+// with the same key is applied by the server only once.
+func (s *HTTPSender) Send(ctx context.Context, key string, metrics ...metric.Metric) error {
 
 	addr := fmt.Sprintf("%s/updates/", s.address)
 
@@ -65,9 +144,7 @@ func (s *HTTPSender) Send(ctx context.Context, metrics ...metric.Metric) error {
 	var hashSum []byte
 
 	if s.hashKey != "" {
-		h := hmac.New(sha256.New, []byte(s.hashKey))
-		h.Write(buf.Bytes())
-		hashSum = h.Sum(nil)
+		hashSum = s.sign(buf.Bytes())
 	}
 
 	var zip bytes.Buffer
@@ -84,26 +161,130 @@ func (s *HTTPSender) Send(ctx context.Context, metrics ...metric.Metric) error {
 		return fmt.Errorf("failed compress data: %w", err)
 	}
 
-	slog.Debug("sending metric", "metric", metrics)
+	body := zip.Bytes()
+
+	if s.pubKey != nil {
+		body, err = encryption.Encrypt(s.pubKey, body)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt data: %w", err)
+		}
+	}
+
+	slog.Debug("sending metric", "metric", metrics, "key", key)
 
-	res, err := s.client.R().
+	req := s.client.R()
+
+	if s.token != "" {
+		req.SetAuthToken(s.token)
+	}
+
+	if s.keyID != "" {
+		req.SetHeader("HashKeyID", s.keyID)
+	}
+
+	if key != "" {
+		req.SetHeader("Idempotency-Key", key)
+	}
+
+	if s.pubKey != nil {
+		req.SetHeader("Encryption", encryption.Scheme)
+	}
+
+	if ip, err := outboundIP(s.address); err == nil {
+		req.SetHeader("X-Real-IP", ip)
+	} else {
+		slog.Warn("failed to resolve outbound address", "error", err)
+	}
+
+	res, err := req.
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("Content-Encoding", "gzip").
 		SetHeader("Accept-Encoding", "gzip").
 		SetHeader("HashSHA256", fmt.Sprintf("%x", hashSum)).
-		SetBody(zip.Bytes()).
+		SetBody(body).
 		Post(addr)
 
 	if err != nil {
 		return fmt.Errorf("failed to do request: %w", err)
 	}
 
-	if res.StatusCode() != http.StatusOK {
+	switch res.StatusCode() {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return &ThrottledError{
+			Status: res.StatusCode(),
+			Wait:   retryAfter(res.Header().Get("Retry-After"), time.Now()),
+		}
+	default:
 		return fmt.Errorf("unexpected response status: %d", res.StatusCode())
 	}
 
+	if hash := res.Header().Get("HashSHA256"); s.hashKey != "" && (hash != "" || s.strict) && !s.verify(res.Body(), hash) {
+		return ErrInvalidResponseSignature
+	}
+
 	slog.Debug("metrics success send")
 
 	return nil
 }
+
+func (s *HTTPSender) sign(data []byte) []byte {
+	h := hmac.New(sha256.New, []byte(s.hashKey))
+	h.Write(data)
+
+	return h.Sum(nil)
+}
+
+// verify checks that a response was signed by a server sharing the key.
+func (s *HTTPSender) verify(body []byte, header string) bool {
+	sum, err := hex.DecodeString(header)
+	if err != nil || header == "" {
+		return false
+	}
+
+	return hmac.Equal(s.sign(body), sum)
+}
+
+// retryAfter parses a Retry-After value given either in seconds or as
+// an HTTP date.
+func retryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+
+	return 0
+}
+
+// outboundIP finds the local address used to reach the server, so that
+// the server can check it against its trusted subnets when the request
+// comes through a proxy of the trusted network. Dialing UDP only picks a
+// route, nothing is sent.
+func outboundIP(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
@@ -0,0 +1,123 @@
+package sender
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPSender_Throttled(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		wait       time.Duration
+	}{
+		{"too many requests", http.StatusTooManyRequests, "7", 7 * time.Second},
+		{"unavailable", http.StatusServiceUnavailable, "", 0},
+		{"date", http.StatusServiceUnavailable, time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := NewHTTPSender(server.URL, "").Send(context.Background(), "key", metric.NewGaugeMetric("load", 1))
+
+			var throttled *ThrottledError
+			require.True(t, errors.As(err, &throttled), "%v", err)
+
+			assert.Equal(t, tt.status, throttled.Status)
+			assert.InDelta(t, tt.wait, throttled.RetryAfter(), float64(2*time.Second))
+		})
+	}
+}
+
+func TestHTTPSender_NoRetries(t *testing.T) {
+	var calls atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		// drop the connection, which resty would retry
+		conn, _, err := http.NewResponseController(w).Hijack()
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+	}))
+	defer server.Close()
+
+	err := NewHTTPSender(server.URL, "").Send(context.Background(), "key", metric.NewGaugeMetric("load", 1))
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "retries are left to the agent backoff")
+}
+
+func TestHTTPSender_ResponseSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		hash   string
+		strict bool
+		err    error
+	}{
+		{"wrongly signed", "00ff", false, ErrInvalidResponseSignature},
+		{"unsigned", "", false, nil},
+		{"unsigned strict", "", true, ErrInvalidResponseSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.hash != "" {
+					w.Header().Set("HashSHA256", tt.hash)
+				}
+
+				_, _ = w.Write([]byte(`ok`))
+			}))
+			defer server.Close()
+
+			s := NewHTTPSender(server.URL, "secret")
+			if tt.strict {
+				s.WithStrictResponse()
+			}
+
+			err := s.Send(context.Background(), "key", metric.NewGaugeMetric("load", 1))
+
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	t.Run("correctly signed", func(t *testing.T) {
+		s := NewHTTPSender("", "secret").WithStrictResponse()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("HashSHA256", hex.EncodeToString(s.sign([]byte(`ok`))))
+			_, _ = w.Write([]byte(`ok`))
+		}))
+		defer server.Close()
+
+		s.address = server.URL
+
+		assert.NoError(t, s.Send(context.Background(), "key", metric.NewGaugeMetric("load", 1)))
+	})
+}
+
+func TestNewHTTPSender_Scheme(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080", NewHTTPSender("localhost:8080", "").address)
+	assert.Equal(t, "https://example.com", NewHTTPSender("https://example.com", "").address)
+	assert.Equal(t, "http://example.com", NewHTTPSender("http://example.com", "").address)
+}
@@ -0,0 +1,180 @@
+// Package encryption seals request payloads for the server's RSA key.
+//
+// A payload is encrypted with a fresh AES-256-GCM key, which is in turn
+// encrypted with RSA-OAEP. The sealed message is the wrapped key followed
+// by the GCM nonce and the ciphertext, so it is self-contained and any
+// payload size is supported.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Scheme names the encryption in the Encryption header of a request.
+const Scheme = "rsa-oaep-aes256-gcm"
+
+// ErrMalformed means a message could not be decrypted with the key.
+var ErrMalformed = errors.New("malformed encrypted message")
+
+const keySize = 32
+
+// Encrypt seals data so that only the holder of the private key of pub
+// can read it.
+func Encrypt(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+	key := make([]byte, keySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(wrapped)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, wrapped...)
+	out = append(out, nonce...)
+
+	return gcm.Seal(out, nonce, data, nil), nil
+}
+
+// Decrypt opens a message sealed by Encrypt for the public part of priv.
+func Decrypt(priv *rsa.PrivateKey, msg []byte) ([]byte, error) {
+	size := priv.Size()
+
+	if len(msg) < size {
+		return nil, ErrMalformed
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, priv, msg[:size], nil)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	msg = msg[size:]
+
+	if len(msg) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	data, err := gcm.Open(nil, msg[:gcm.NonceSize()], msg[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// LoadPublicKey reads a PEM encoded RSA public key in PKIX or PKCS #1
+// form, or takes the key of a PEM certificate.
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key any
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an RSA key", path)
+	}
+
+	return pub, nil
+}
+
+// LoadPrivateKey reads a PEM encoded RSA private key in PKCS #1 or
+// PKCS #8 form.
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+
+		return priv, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an RSA key", path)
+	}
+
+	return priv, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,94 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data := make([]byte, 10_000)
+	_, err = rand.Read(data)
+	require.NoError(t, err)
+
+	msg, err := Encrypt(&priv.PublicKey, data)
+	require.NoError(t, err)
+
+	plain, err := Decrypt(priv, msg)
+	require.NoError(t, err)
+	assert.Equal(t, data, plain)
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := append([]byte(nil), msg...)
+		tampered[len(tampered)-1] ^= 1
+
+		_, err := Decrypt(priv, tampered)
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := Decrypt(priv, msg[:priv.Size()-1])
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		_, err = Decrypt(other, msg)
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
+
+func TestLoadKeys(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	pkix, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+
+		return path
+	}
+
+	for _, path := range []string{
+		write("pkcs1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv)),
+		write("pkcs8.pem", "PRIVATE KEY", pkcs8),
+	} {
+		loaded, err := LoadPrivateKey(path)
+		require.NoError(t, err, path)
+		assert.True(t, priv.Equal(loaded), path)
+	}
+
+	for _, path := range []string{
+		write("pkcs1.pub", "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&priv.PublicKey)),
+		write("pkix.pub", "PUBLIC KEY", pkix),
+	} {
+		loaded, err := LoadPublicKey(path)
+		require.NoError(t, err, path)
+		assert.True(t, priv.PublicKey.Equal(loaded), path)
+	}
+
+	_, err = LoadPublicKey(write("garbage.pub", "PUBLIC KEY", []byte("garbage")))
+	assert.Error(t, err)
+
+	_, err = LoadPrivateKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
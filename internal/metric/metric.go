@@ -11,6 +11,8 @@ var (
 	ErrMetricNotFound = errors.New("metric not found")
 	ErrEmptyID        = errors.New("empty metric id")
 	ErrIncorrectValue = errors.New("incorrect metric value")
+
+	ErrStorageUnavailable = errors.New("metric storage unavailable")
 )
 
 type Metric struct {
@@ -62,3 +64,59 @@ func (m Metric) ValueToString() string {
 	}
 	return strings.TrimRight(fmt.Sprintf("%.3f", *m.Value), "0.")
 }
+
+// FormatValue formats the value without losing precision, unlike
+// ValueToString which rounds gauges for the legacy text endpoint.
+func (m Metric) FormatValue() string {
+	if m.MType == Counter {
+		return strconv.FormatInt(*m.Delta, 10)
+	}
+
+	return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+}
+
+// Merge collapses metrics with the same type and id into one: counter
+// deltas are summed and the last gauge value wins. The order of first
+// appearance is preserved.
+func Merge(metrics ...Metric) []Metric {
+	merged := make([]Metric, 0, len(metrics))
+	index := make(map[Type]map[string]int, 2)
+
+	for _, m := range metrics {
+		ids, ok := index[m.MType]
+		if !ok {
+			ids = make(map[string]int)
+			index[m.MType] = ids
+		}
+
+		i, ok := ids[m.ID]
+		if !ok {
+			ids[m.ID] = len(merged)
+			merged = append(merged, m.clone())
+			continue
+		}
+
+		if m.MType == Counter && merged[i].Delta != nil && m.Delta != nil {
+			*merged[i].Delta += *m.Delta
+			continue
+		}
+
+		merged[i] = m.clone()
+	}
+
+	return merged
+}
+
+func (m Metric) clone() Metric {
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+
+	return m
+}
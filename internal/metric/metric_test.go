@@ -82,3 +82,43 @@ func TestMetric_ValueToString(t *testing.T) {
 		assert.Equal(t, strings.TrimRight(fmt.Sprintf("%.3f", *m.Value), "0."), m.ValueToString())
 	})
 }
+
+func TestMetric_FormatValue(t *testing.T) {
+	tests := []struct {
+		m    Metric
+		want string
+	}{
+		{NewCounterMetric("c", 10), "10"},
+		{NewCounterMetric("c", 0), "0"},
+		{NewGaugeMetric("g", 10), "10"},
+		{NewGaugeMetric("g", 0), "0"},
+		{NewGaugeMetric("g", 0.5), "0.5"},
+		{NewGaugeMetric("g", 10.0001), "10.0001"},
+		{NewGaugeMetric("g", -3.25), "-3.25"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.m.FormatValue())
+	}
+}
+
+func TestMerge(t *testing.T) {
+	counter := NewCounterMetric("counter", 1)
+
+	merged := Merge(
+		counter,
+		NewGaugeMetric("gauge", 1),
+		NewCounterMetric("counter", 2),
+		NewGaugeMetric("counter", 5),
+		NewGaugeMetric("gauge", 3),
+		NewCounterMetric("counter", 4),
+	)
+
+	assert.Equal(t, []Metric{
+		NewCounterMetric("counter", 7),
+		NewGaugeMetric("gauge", 3),
+		NewGaugeMetric("counter", 5),
+	}, merged)
+
+	assert.Equal(t, int64(1), *counter.Delta)
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("read, WRITE,read")
+	require.NoError(t, err)
+	assert.Equal(t, []Scope{ScopeRead, ScopeWrite}, scopes)
+
+	_, err = ParseScopes("read,root")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, err = ParseScopes(" , ")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestIssue(t *testing.T) {
+	token, secret, err := Issue("agent", []Scope{ScopeWrite})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(secret, secretPrefix))
+	assert.Equal(t, Hash(secret), token.Hash)
+	assert.NotEmpty(t, token.ID)
+	assert.Equal(t, "agent", token.Name)
+
+	other, otherSecret, err := Issue("agent", []Scope{ScopeWrite})
+	require.NoError(t, err)
+	assert.NotEqual(t, token.ID, other.ID)
+	assert.NotEqual(t, secret, otherSecret)
+
+	_, _, err = Issue("bad", []Scope{"root"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	_, _, err = Issue("none", nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestToken_Allows(t *testing.T) {
+	writer := Token{Scopes: []Scope{ScopeWrite}}
+	assert.True(t, writer.Allows(ScopeWrite))
+	assert.False(t, writer.Allows(ScopeRead))
+	assert.False(t, writer.Allows(ScopeAdmin))
+
+	admin := Token{Scopes: []Scope{ScopeAdmin}}
+	assert.True(t, admin.Allows(ScopeRead))
+	assert.True(t, admin.Allows(ScopeWrite))
+
+	assert.False(t, Token{}.Allows(ScopeRead))
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	token, ok := FromContext(WithToken(context.Background(), Token{ID: "id"}))
+	assert.True(t, ok)
+	assert.Equal(t, "id", token.ID)
+}
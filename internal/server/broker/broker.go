@@ -0,0 +1,120 @@
+// Package broker fans committed metric updates out to in-process
+// subscribers such as live streams.
+package broker
+
+import (
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"log/slog"
+	"path"
+	"slices"
+	"sync"
+)
+
+// subscriptionBuffer is how many updates a subscriber may lag behind
+// before further updates are dropped for it.
+const subscriptionBuffer = 256
+
+// Filter selects updates by type and by an id glob pattern as in
+// path.Match. Empty fields match everything.
+type Filter struct {
+	Types []metric.Type
+	ID    string
+}
+
+func (f Filter) Validate() error {
+	for _, t := range f.Types {
+		if !t.IsValid() {
+			return metric.ErrIncorrectType
+		}
+	}
+
+	if _, err := path.Match(f.ID, ""); err != nil {
+		return fmt.Errorf("%w: malformed id pattern", metric.ErrIncorrectValue)
+	}
+
+	return nil
+}
+
+func (f Filter) match(m metric.Metric) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, m.MType) {
+		return false
+	}
+
+	if f.ID == "" {
+		return true
+	}
+
+	ok, _ := path.Match(f.ID, m.ID)
+
+	return ok
+}
+
+type Subscription struct {
+	filter Filter
+	ch     chan metric.Metric
+	broker *Broker
+}
+
+// C delivers matching updates until the subscription is closed.
+func (s *Subscription) C() <-chan metric.Metric {
+	return s.ch
+}
+
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+type Broker struct {
+	mx   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+func (b *Broker) Subscribe(filter Filter) *Subscription {
+	s := &Subscription{
+		filter: filter,
+		ch:     make(chan metric.Metric, subscriptionBuffer),
+		broker: b,
+	}
+
+	b.mx.Lock()
+	b.subs[s] = struct{}{}
+	b.mx.Unlock()
+
+	return s
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Publish never blocks: a subscriber whose buffer is full misses the
+// update instead of stalling the writer.
+func (b *Broker) Publish(metrics ...metric.Metric) {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+
+	for s := range b.subs {
+		for _, m := range metrics {
+			if !s.filter.match(m) {
+				continue
+			}
+
+			select {
+			case s.ch <- m:
+			default:
+				slog.Warn("metric subscriber is too slow, update dropped", "id", m.ID)
+			}
+		}
+	}
+}
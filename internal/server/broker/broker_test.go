@@ -0,0 +1,60 @@
+package broker
+
+import (
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+
+	all := b.Subscribe(Filter{})
+	counters := b.Subscribe(Filter{Types: []metric.Type{metric.Counter}})
+	cpu := b.Subscribe(Filter{ID: "cpu*"})
+
+	b.Publish(
+		metric.NewCounterMetric("requests", 1),
+		metric.NewGaugeMetric("cpu_1", 0.5),
+	)
+
+	assert.Len(t, all.C(), 2)
+	assert.Len(t, counters.C(), 1)
+	assert.Len(t, cpu.C(), 1)
+
+	assert.Equal(t, "requests", (<-counters.C()).ID)
+	assert.Equal(t, "cpu_1", (<-cpu.C()).ID)
+
+	all.Close()
+	all.Close()
+
+	_, ok := <-all.C()
+	assert.True(t, ok)
+	_, ok = <-all.C()
+	assert.True(t, ok)
+	_, ok = <-all.C()
+	assert.False(t, ok)
+
+	b.Publish(metric.NewCounterMetric("requests", 2))
+
+	assert.Len(t, counters.C(), 1)
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker()
+
+	s := b.Subscribe(Filter{})
+
+	for i := 0; i < subscriptionBuffer+10; i++ {
+		b.Publish(metric.NewCounterMetric("requests", int64(i)))
+	}
+
+	require.Len(t, s.C(), subscriptionBuffer)
+}
+
+func TestFilter_Validate(t *testing.T) {
+	assert.NoError(t, Filter{Types: []metric.Type{metric.Gauge}, ID: "cpu_*"}.Validate())
+	assert.ErrorIs(t, Filter{Types: []metric.Type{"histogram"}}.Validate(), metric.ErrIncorrectType)
+	assert.ErrorIs(t, Filter{ID: "cpu["}.Validate(), metric.ErrIncorrectValue)
+}
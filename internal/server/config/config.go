@@ -2,8 +2,12 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/caarlos0/env/v11"
 	"log"
+	"log/slog"
+	"net/url"
+	"strings"
 )
 
 type Config struct {
@@ -12,7 +16,71 @@ type Config struct {
 	StoreInterval int64  `env:"STORE_INTERVAL" envDefault:"300"`
 	Restore       bool   `env:"RESTORE" envDefault:"true"`
 	DatabaseDsn   string `env:"DATABASE_DSN"`
+	BoltPath      string `env:"BOLT_PATH"`
 	HashKey       string `env:"KEY"`
+	HashStrict    bool   `env:"HASH_STRICT"`
+	// HashKeys are additional signing keys by key id, accepted alongside
+	// HashKey while agents are rotated to a new key.
+	HashKeys map[string]string `env:"KEYS" envSeparator:"," envKeyValSeparator:":"`
+	// CryptoKey is the path to the PEM private key that opens encrypted
+	// request bodies.
+	CryptoKey string `env:"CRYPTO_KEY"`
+
+	// TLSCert and TLSKey switch the server to HTTPS. With TLSClientCA set
+	// clients have to present a certificate issued by one of its CAs.
+	TLSCert     string `env:"TLS_CERT"`
+	TLSKey      string `env:"TLS_KEY"`
+	TLSClientCA string `env:"TLS_CLIENT_CA"`
+
+	// TrustedSubnets are the CIDRs agents may write from. Any address may
+	// write when it is empty.
+	TrustedSubnets []string `env:"TRUSTED_SUBNET" envSeparator:","`
+
+	// RateLimit is the average number of requests per second allowed to
+	// a client, zero turns limiting off.
+	RateLimit   float64 `env:"RATE_LIMIT"`
+	RateBurst   int     `env:"RATE_BURST" envDefault:"20"`
+	MaxBodySize int64   `env:"MAX_BODY_SIZE" envDefault:"10485760"`
+	MaxBatch    int     `env:"MAX_BATCH" envDefault:"10000"`
+
+	IdempotencyTTL int64 `env:"IDEMPOTENCY_TTL" envDefault:"86400"`
+
+	Auth bool `env:"AUTH"`
+}
+
+// LogValue hides the signing keys and the database password, so the
+// config can be logged at start.
+func (c Config) LogValue() slog.Value {
+	type plain Config
+
+	p := plain(c)
+	p.HashKey = redact(p.HashKey)
+
+	if len(c.HashKeys) > 0 {
+		p.HashKeys = make(map[string]string, len(c.HashKeys))
+
+		for id, key := range c.HashKeys {
+			p.HashKeys[id] = redact(key)
+		}
+	}
+
+	if u, err := url.Parse(c.DatabaseDsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+		}
+
+		p.DatabaseDsn = u.String()
+	}
+
+	return slog.AnyValue(p)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return "[redacted]"
 }
 
 func MustLoad() Config {
@@ -24,7 +92,27 @@ func MustLoad() Config {
 	flag.Int64Var(&conf.StoreInterval, "i", 300, "flush to file storage interval on seconds (0 - sync store)")
 	flag.BoolVar(&conf.Restore, "r", true, "restore storage from file when running")
 	flag.StringVar(&conf.DatabaseDsn, "d", "", "dsn for connection to database")
+	flag.StringVar(&conf.BoltPath, "b", "", "path to embedded bolt database file")
 	flag.StringVar(&conf.HashKey, "k", "", "key for hash sign")
+	flag.Func("keys", "additional signing keys as id:key pairs separated by commas", func(s string) (err error) {
+		conf.HashKeys, err = parseKeys(s)
+		return err
+	})
+	flag.StringVar(&conf.CryptoKey, "crypto-key", "", "path to the private key for encrypted requests")
+	flag.StringVar(&conf.TLSCert, "tls-cert", "", "path to the server TLS certificate")
+	flag.StringVar(&conf.TLSKey, "tls-key", "", "path to the server TLS key")
+	flag.StringVar(&conf.TLSClientCA, "tls-client-ca", "", "path to the CA bundle client certificates are verified with")
+	flag.Func("t", "trusted subnets in CIDR notation separated by commas", func(s string) error {
+		conf.TrustedSubnets = strings.Split(s, ",")
+		return nil
+	})
+	flag.Float64Var(&conf.RateLimit, "rate-limit", 0, "requests per second allowed to a client (0 - unlimited)")
+	flag.IntVar(&conf.RateBurst, "rate-burst", 20, "requests a client may make at once")
+	flag.Int64Var(&conf.MaxBodySize, "max-body-size", 10<<20, "max request body size in bytes after decompression (0 - unlimited)")
+	flag.IntVar(&conf.MaxBatch, "max-batch", 10000, "max metrics in one batch (0 - unlimited)")
+	flag.BoolVar(&conf.HashStrict, "hash-strict", false, "reject unsigned requests instead of only checking signed ones")
+	flag.BoolVar(&conf.Auth, "auth", false, "require bearer tokens with matching scopes")
+	flag.Int64Var(&conf.IdempotencyTTL, "idempotency-ttl", 86400, "how long applied idempotency keys are remembered in seconds")
 
 	err := env.Parse(&conf)
 	if err != nil {
@@ -33,5 +121,25 @@ func MustLoad() Config {
 
 	flag.Parse()
 
+	// a limiter with an empty bucket would refuse every request
+	if conf.RateLimit > 0 && conf.RateBurst <= 0 {
+		log.Fatalf("RATE_BURST must be positive when RATE_LIMIT is set, got %d", conf.RateBurst)
+	}
+
 	return conf
 }
+
+func parseKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		id, key, ok := strings.Cut(pair, ":")
+		if !ok || id == "" || key == "" {
+			return nil, fmt.Errorf("malformed key pair %q", pair)
+		}
+
+		keys[id] = key
+	}
+
+	return keys, nil
+}
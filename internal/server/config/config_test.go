@@ -0,0 +1,28 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestConfig_LogValue(t *testing.T) {
+	var buf bytes.Buffer
+
+	conf := Config{
+		Address:     "localhost:8080",
+		DatabaseDsn: "postgres://user:hunter2@db:5432/metrics",
+		HashKey:     "secret-key",
+		HashKeys:    map[string]string{"next": "rotated-key"},
+	}
+
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("running", "env", conf)
+
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.NotContains(t, buf.String(), "secret-key")
+	assert.NotContains(t, buf.String(), "rotated-key")
+	assert.Contains(t, buf.String(), "localhost:8080")
+	assert.Contains(t, buf.String(), `"next":"[redacted]"`)
+	assert.Contains(t, buf.String(), "user:redacted@db")
+}
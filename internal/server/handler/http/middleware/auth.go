@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"net/http"
+	"strings"
+)
+
+// TokenCookie carries the token of a browser, which can not send a
+// bearer header when it loads a page.
+const TokenCookie = "metricollector_token"
+
+type tokenFinder interface {
+	Find(ctx context.Context, hash string) (auth.Token, error)
+}
+
+// Authenticate resolves the bearer token of a request and puts it into
+// the request context. Requests without a token continue anonymously,
+// so public routes keep working; Authorize decides what they may reach.
+//
+// Without the header, safe requests may carry the token in TokenCookie.
+// A cookie is sent by the browser on its own, so it never authorizes
+// changes, and an unknown one is ignored instead of locking the browser
+// out of public pages.
+func Authenticate(tokens tokenFinder) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+
+			if header == "" {
+				next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), cookieToken(r, tokens))))
+				return
+			}
+
+			scheme, secret, _ := strings.Cut(header, " ")
+			if !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(secret) == "" {
+				unauthorized(w)
+				return
+			}
+
+			token, err := tokens.Find(r.Context(), auth.Hash(strings.TrimSpace(secret)))
+			if errors.Is(err, auth.ErrTokenNotFound) {
+				unauthorized(w)
+				return
+			}
+
+			if err != nil {
+				response.Error(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithToken(r.Context(), token)))
+		})
+	}
+}
+
+// Authorize lets through requests whose token grants scope. Routes stay
+// open when Authenticate is not installed, i.e. authentication is off.
+// Requests marked by TrustedSubnets only get the read scope.
+func Authorize(scope auth.Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scope != auth.ScopeRead && untrusted(r.Context()) {
+				response.Error(w, response.ErrUntrustedNetwork)
+				return
+			}
+
+			token, ok := auth.FromContext(r.Context())
+
+			switch {
+			case !ok:
+			case token.ID == "":
+				unauthorized(w)
+				return
+			case !token.Allows(scope):
+				response.Error(w, auth.ErrForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func cookieToken(r *http.Request, tokens tokenFinder) auth.Token {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return auth.Token{}
+	}
+
+	cookie, err := r.Cookie(TokenCookie)
+	if err != nil || cookie.Value == "" {
+		return auth.Token{}
+	}
+
+	token, err := tokens.Find(r.Context(), auth.Hash(cookie.Value))
+	if err != nil {
+		return auth.Token{}
+	}
+
+	return token
+}
+
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="metricollector"`)
+	response.Error(w, auth.ErrUnauthorized)
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	tokens, err := memory.NewTokenStore("")
+	require.NoError(t, err)
+
+	issue := func(scopes ...auth.Scope) string {
+		token, secret, err := auth.Issue("test", scopes)
+		require.NoError(t, err)
+		require.NoError(t, tokens.Create(context.Background(), token))
+
+		return secret
+	}
+
+	reader := issue(auth.ScopeRead)
+	writer := issue(auth.ScopeWrite)
+	admin := issue(auth.ScopeAdmin)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	do := func(handler http.Handler, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(Authorize(auth.ScopeWrite)(ok), "").Code)
+	})
+
+	handler := Authenticate(tokens)(Authorize(auth.ScopeWrite)(ok))
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"unknown token", "Bearer mc_unknown", http.StatusUnauthorized},
+		{"other scheme", "Basic " + writer, http.StatusUnauthorized},
+		{"empty token", "Bearer ", http.StatusUnauthorized},
+		{"missing scope", "Bearer " + reader, http.StatusForbidden},
+		{"scope granted", "Bearer " + writer, http.StatusOK},
+		{"scheme is case insensitive", "bearer " + writer, http.StatusOK},
+		{"admin grants everything", "Bearer " + admin, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(handler, tt.authorization)
+
+			assert.Equal(t, tt.status, rec.Code)
+
+			if tt.status == http.StatusUnauthorized {
+				assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+
+	t.Run("public route", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(Authenticate(tokens)(ok), "").Code)
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		read := Authenticate(tokens)(Authorize(auth.ScopeRead)(ok))
+
+		cookie := func(method, secret string) int {
+			req := httptest.NewRequest(method, "/dashboard/", nil)
+			req.AddCookie(&http.Cookie{Name: TokenCookie, Value: secret})
+
+			rec := httptest.NewRecorder()
+			read.ServeHTTP(rec, req)
+
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusOK, cookie(http.MethodGet, reader))
+		assert.Equal(t, http.StatusUnauthorized, cookie(http.MethodGet, "mc_unknown"))
+		assert.Equal(t, http.StatusUnauthorized, cookie(http.MethodPost, admin), "a cookie does not authorize changes")
+	})
+}
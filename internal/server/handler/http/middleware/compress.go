@@ -78,6 +78,11 @@ func (w gzipWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w gzipWriter) Close() error {
 	contentEncoding := w.ResponseWriter.Header().Get(_contentEncoding)
 	sendsGzip := strings.Contains(contentEncoding, "gzip")
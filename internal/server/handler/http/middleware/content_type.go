@@ -1,13 +1,14 @@
 package middleware
 
 import (
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
 	"net/http"
 )
 
 func AcceptedContentTypeJSON(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Content-Type") != "application/json" {
-			w.WriteHeader(http.StatusNotAcceptable)
+			response.Error(w, response.ErrNotAcceptable)
 			return
 		}
 
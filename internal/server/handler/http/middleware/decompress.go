@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"compress/gzip"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
 	"io"
 	"log/slog"
 	"net/http"
@@ -17,10 +18,9 @@ func GzipDecompress(h http.Handler) http.Handler {
 		if sendsGzip {
 			cr, err := newGzipReader(r.Body)
 			if err != nil {
-				slog.Error("failed to create new gzip reader", "error", err)
-				w.WriteHeader(http.StatusInternalServerError)
+				slog.Warn("failed to create new gzip reader", "error", err)
+				response.Error(w, response.ErrInvalidEncoding)
 				return
-
 			}
 
 			r.Body = cr
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzipDecompress(t *testing.T) {
+	var zipped bytes.Buffer
+
+	zw := gzip.NewWriter(&zipped)
+	_, err := zw.Write([]byte(`{"id":"x"}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	corrupt := bytes.Clone(zipped.Bytes())
+	corrupt[len(corrupt)-5] ^= 0xff
+
+	handler := GzipDecompress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			response.Error(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		body   []byte
+		status int
+	}{
+		{"gzip", zipped.Bytes(), http.StatusOK},
+		{"not gzip", []byte(`{"id":"x"}`), http.StatusBadRequest},
+		{"corrupt", corrupt, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", "gzip")
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+
+			if tt.status == http.StatusBadRequest {
+				assert.Contains(t, rec.Body.String(), `"invalid_encoding"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/encryption"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"io"
+	"net/http"
+)
+
+// EncryptionHeader names the scheme a request body is encrypted with.
+const EncryptionHeader = "Encryption"
+
+// Decrypt opens request bodies encrypted for key. It has to run before
+// GzipDecompress, because the compressed body is what gets encrypted.
+// Requests without EncryptionHeader are passed through as is.
+func Decrypt(key *rsa.PrivateKey) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(EncryptionHeader)
+			if scheme == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if scheme != encryption.Scheme {
+				response.Error(w, response.ErrInvalidEncryption)
+				return
+			}
+
+			msg, err := io.ReadAll(r.Body)
+			if err != nil {
+				response.Error(w, fmt.Errorf("failed to read encrypted body: %w", err))
+				return
+			}
+
+			data, err := encryption.Decrypt(key, msg)
+			if err != nil {
+				response.Error(w, response.ErrInvalidEncryption)
+				return
+			}
+
+			r.Header.Del(EncryptionHeader)
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			r.ContentLength = int64(len(data))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
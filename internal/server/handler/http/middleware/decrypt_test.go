@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/baisalov/metricollector/internal/encryption"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecrypt(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var zip bytes.Buffer
+
+	zw := gzip.NewWriter(&zip)
+	_, err = zw.Write([]byte(`{"id":"x"}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	sealed, err := encryption.Encrypt(&priv.PublicKey, zip.Bytes())
+	require.NoError(t, err)
+
+	var got string
+
+	handler := Decrypt(priv)(GzipDecompress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		got = string(body)
+	})))
+
+	tests := []struct {
+		name    string
+		scheme  string
+		body    []byte
+		status  int
+		decoded string
+	}{
+		{"encrypted", encryption.Scheme, sealed, http.StatusOK, `{"id":"x"}`},
+		{"plain", "", zip.Bytes(), http.StatusOK, `{"id":"x"}`},
+		{"tampered", encryption.Scheme, append(sealed[:len(sealed)-1:len(sealed)-1], sealed[len(sealed)-1]^1), http.StatusBadRequest, ""},
+		{"unknown scheme", "rot13", sealed, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+			req.Header.Set(_contentEncoding, "gzip")
+
+			if tt.scheme != "" {
+				req.Header.Set(EncryptionHeader, tt.scheme)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.decoded, got)
+
+			if tt.status != http.StatusOK {
+				assert.True(t, strings.Contains(rec.Body.String(), "invalid_encryption"), rec.Body.String())
+			}
+		})
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type hashStatusReWriter struct {
@@ -24,16 +28,25 @@ func (w hashStatusReWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-func HashCheck(key string) func(next http.Handler) http.Handler {
+// Keys are the HMAC keys accepted for signatures by key id. During a
+// rotation both the old and the new key are listed. The key with the
+// empty id is used for requests that do not name one.
+type Keys map[string]string
+
+func (k Keys) lookup(r *http.Request) (string, bool) {
+	key, ok := k[r.Header.Get(HashKeyIDHeader)]
+	return key, ok
+}
+
+func HashCheck(keys Keys) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			if r.Header.Get("HashSHA256") != "" && r.Method == http.MethodPost {
+			if r.Header.Get(HashHeader) != "" && r.Method == http.MethodPost {
 
-				isCorrect, err := checkHash(r, key)
+				isCorrect, err := checkHash(r, keys)
 				if err != nil {
-					slog.Error(err.Error())
-					w.WriteHeader(http.StatusInternalServerError)
+					response.Error(w, err)
 					return
 				}
 
@@ -48,8 +61,176 @@ func HashCheck(key string) func(next http.Handler) http.Handler {
 	}
 }
 
-func checkHash(r *http.Request, key string) (bool, error) {
-	sum, err := hex.DecodeString(r.Header.Get("HashSHA256"))
+const (
+	// HashHeader carries the hex HMAC-SHA256 of the uncompressed body of
+	// a request or response.
+	HashHeader = "HashSHA256"
+	// HashKeyIDHeader names the key HashHeader was computed with.
+	HashKeyIDHeader = "HashKeyID"
+)
+
+// VerifySignature is the strict counterpart of HashCheck: writes must be
+// signed, and unsigned or incorrectly signed ones are rejected before
+// they reach the handler. Writes without a body are signed over their
+// path, see checkHash.
+func VerifySignature(keys Keys) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Header.Get(HashHeader) == "" {
+				slog.Warn("unsigned request rejected", "path", r.URL.Path)
+				response.Error(w, response.ErrInvalidSignature)
+				return
+			}
+
+			isCorrect, err := checkHash(r, keys)
+
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				response.Error(w, err)
+				return
+			}
+
+			if err != nil || !isCorrect {
+				slog.Warn("invalid body sign", "path", r.URL.Path, "error", err)
+				response.Error(w, response.ErrInvalidSignature)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SignResponse adds HashHeader to responses, computed with the key the
+// request named. The body is buffered to be signed, except for streams
+// and downloads, which may be large and are not read by agents, so they
+// are passed through unsigned, as are responses to requests naming an
+// unknown key.
+func SignResponse(keys Keys) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &signingResponseWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			if sw.passThrough {
+				return
+			}
+
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+
+			if key, ok := keys.lookup(r); ok {
+				if id := r.Header.Get(HashKeyIDHeader); id != "" {
+					w.Header().Set(HashKeyIDHeader, id)
+				}
+
+				w.Header().Set(HashHeader, hex.EncodeToString(sign(key, sw.body.Bytes())))
+			}
+
+			w.WriteHeader(sw.status)
+
+			if _, err := w.Write(sw.body.Bytes()); err != nil {
+				slog.Error("failed to write response body", "error", err)
+			}
+		})
+	}
+}
+
+type signingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	passThrough bool
+	body        bytes.Buffer
+}
+
+// unsignedTypes are the content types of streams and exports.
+var unsignedTypes = []string{
+	"text/event-stream",
+	"text/csv",
+	"application/x-ndjson",
+	"application/octet-stream",
+}
+
+func unsigned(header http.Header) bool {
+	if header.Get("Content-Disposition") != "" {
+		return true
+	}
+
+	contentType := header.Get("Content-Type")
+
+	for _, t := range unsignedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *signingResponseWriter) WriteHeader(statusCode int) {
+	if w.status != 0 || w.passThrough {
+		return
+	}
+
+	if unsigned(w.Header()) {
+		w.passThrough = true
+		w.ResponseWriter.WriteHeader(statusCode)
+
+		return
+	}
+
+	w.status = statusCode
+}
+
+func (w *signingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 && !w.passThrough {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.passThrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	return w.body.Write(b)
+}
+
+// FlushError only flushes streams, buffered bodies are sent once signed.
+func (w *signingResponseWriter) FlushError() error {
+	if !w.passThrough {
+		return nil
+	}
+
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// SetWriteDeadline lets long streams lift the server write timeout.
+func (w *signingResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	return http.NewResponseController(w.ResponseWriter).SetWriteDeadline(deadline)
+}
+
+func sign(key string, data []byte) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(data)
+
+	return h.Sum(nil)
+}
+
+func checkHash(r *http.Request, keys Keys) (bool, error) {
+	key, ok := keys.lookup(r)
+	if !ok {
+		return false, nil
+	}
+
+	sum, err := hex.DecodeString(r.Header.Get(HashHeader))
 	if err != nil {
 		return false, fmt.Errorf("failed to decode hex string: %w", err)
 	}
@@ -65,9 +246,12 @@ func checkHash(r *http.Request, key string) (bool, error) {
 
 	r.Body = io.NopCloser(&buf)
 
-	h := hmac.New(sha256.New, []byte(key))
-	h.Write(data)
-	sign := h.Sum(nil)
+	// the signature of an empty body would be the same for every request
+	// and could be replayed to any write route, so writes without a body,
+	// like the URL-only update, sign their path instead
+	if len(data) == 0 {
+		data = []byte(r.URL.Path)
+	}
 
-	return bytes.EqualFold(sign, sum[:]), nil
+	return hmac.Equal(sign(key, data), sum), nil
 }
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testKey = "secret"
+
+var testKeys = Keys{"": testKey, "next": "rotated"}
+
+func signed(body string) string {
+	return hex.EncodeToString(sign(testKey, []byte(body)))
+}
+
+func TestVerifySignature(t *testing.T) {
+	calls := 0
+
+	handler := VerifySignature(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"id":"x"}`, string(body))
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		keyID  string
+		hash   string
+		status int
+		calls  int
+	}{
+		{"signed", http.MethodPost, "", signed(`{"id":"x"}`), http.StatusOK, 1},
+		{"signed with rotated key", http.MethodPost, "next", hex.EncodeToString(sign("rotated", []byte(`{"id":"x"}`))), http.StatusOK, 1},
+		{"signed with other key than named", http.MethodPost, "next", signed(`{"id":"x"}`), http.StatusBadRequest, 0},
+		{"unknown key id", http.MethodPost, "old", signed(`{"id":"x"}`), http.StatusBadRequest, 0},
+		{"unsigned", http.MethodPost, "", "", http.StatusBadRequest, 0},
+		{"wrong signature", http.MethodPut, "", signed(`{"id":"y"}`), http.StatusBadRequest, 0},
+		{"not hex", http.MethodPatch, "", "zz", http.StatusBadRequest, 0},
+		{"read without body", http.MethodGet, "", "", http.StatusOK, 1},
+	}
+
+	t.Run("write without body", func(t *testing.T) {
+		pathHandler := VerifySignature(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		tests := []struct {
+			name   string
+			hash   string
+			status int
+		}{
+			{"path signed", signed("/update/counter/x/1"), http.StatusOK},
+			// the signature of an empty body is the same for every request
+			{"empty body signed", signed(""), http.StatusBadRequest},
+			{"other path signed", signed("/update/counter/x/2"), http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/update/counter/x/1", nil)
+				req.Header.Set(HashHeader, tt.hash)
+
+				rec := httptest.NewRecorder()
+				pathHandler.ServeHTTP(rec, req)
+
+				assert.Equal(t, tt.status, rec.Code)
+			})
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+
+			req := httptest.NewRequest(tt.method, "/update/", strings.NewReader(`{"id":"x"}`))
+			if tt.hash != "" {
+				req.Header.Set(HashHeader, tt.hash)
+			}
+
+			if tt.keyID != "" {
+				req.Header.Set(HashKeyIDHeader, tt.keyID)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.calls, calls)
+
+			if tt.status == http.StatusBadRequest {
+				assert.Contains(t, rec.Body.String(), "invalid_signature")
+			}
+		})
+	}
+}
+
+func TestSignResponse(t *testing.T) {
+	t.Run("buffered body", func(t *testing.T) {
+		handler := SignResponse(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":`))
+			_, _ = w.Write([]byte(`"x"}`))
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update/", nil))
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, `{"id":"x"}`, rec.Body.String())
+		assert.Equal(t, signed(`{"id":"x"}`), rec.Header().Get(HashHeader))
+	})
+
+	t.Run("signed with the key of the request", func(t *testing.T) {
+		handler := SignResponse(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`ok`))
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+		req.Header.Set(HashKeyIDHeader, "next")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, "next", rec.Header().Get(HashKeyIDHeader))
+		assert.Equal(t, hex.EncodeToString(sign("rotated", []byte(`ok`))), rec.Header().Get(HashHeader))
+
+		req.Header.Set(HashKeyIDHeader, "unknown")
+
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, "ok", rec.Body.String())
+		assert.Empty(t, rec.Header().Get(HashHeader))
+	})
+
+	t.Run("implicit status", func(t *testing.T) {
+		handler := SignResponse(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`ok`))
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, signed(`ok`), rec.Header().Get(HashHeader))
+	})
+
+	t.Run("event stream", func(t *testing.T) {
+		handler := SignResponse(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("event: metric\n\n"))
+
+			require.NoError(t, http.NewResponseController(w).Flush())
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/metrics/stream", nil))
+
+		assert.True(t, rec.Flushed)
+		assert.Empty(t, rec.Header().Get(HashHeader))
+		assert.Equal(t, "event: metric\n\n", rec.Body.String())
+	})
+
+	t.Run("downloads", func(t *testing.T) {
+		headers := []http.Header{
+			{"Content-Type": {"text/csv"}},
+			{"Content-Type": {"application/x-ndjson"}},
+			{"Content-Type": {"application/octet-stream"}, "Content-Disposition": {`attachment; filename="metrics.db"`}},
+			{"Content-Disposition": {"attachment"}},
+		}
+
+		for _, header := range headers {
+			rec := httptest.NewRecorder()
+
+			handler := SignResponse(testKeys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte("data"))
+
+				assert.Equal(t, "data", rec.Body.String(), "the body is not buffered")
+			}))
+
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/metrics/export.csv", nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, rec.Header().Get(HashHeader))
+			assert.Equal(t, "data", rec.Body.String())
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"log/slog"
+	"net/http"
+)
+
+type idempotencyStore interface {
+	Begin(ctx context.Context, key string) (*idempotency.Result, error)
+	Complete(ctx context.Context, key string, res idempotency.Result) error
+	Abort(ctx context.Context, key string) error
+}
+
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	w.body.Write(b)
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Idempotency replays the recorded response for POST requests whose
+// Idempotency-Key was already processed instead of applying them again.
+// Responses with 5xx statuses are not remembered, so such requests can
+// be retried with the same key.
+//
+// Routes authorize the request only after this lookup, so keys are
+// scoped to the token put into the context by Authenticate and 401 and
+// 403 responses are not remembered: a response is only ever replayed to
+// the client it was given to, and a refused request can be retried once
+// it is allowed.
+func Idempotency(store idempotencyStore) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			key := r.Header.Get(idempotency.Header)
+
+			if key == "" || r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key = r.URL.Path + " " + key
+
+			if token, ok := auth.FromContext(r.Context()); ok && token.ID != "" {
+				key = token.ID + " " + key
+			}
+
+			res, err := store.Begin(r.Context(), key)
+			if err != nil {
+				if !errors.Is(err, idempotency.ErrInProgress) {
+					slog.Error("failed to check idempotency key", "error", err)
+				}
+
+				response.Error(w, err)
+				return
+			}
+
+			if res != nil {
+				slog.Debug("replay idempotent response", "key", key)
+
+				if res.ContentType != "" {
+					w.Header().Set("Content-Type", res.ContentType)
+				}
+
+				w.WriteHeader(res.Status)
+
+				if _, err = w.Write(res.Body); err != nil {
+					slog.Error("failed to write response body", "error", err)
+				}
+
+				return
+			}
+
+			rw := &recordingResponseWriter{ResponseWriter: w}
+
+			next.ServeHTTP(rw, r)
+
+			ctx := context.WithoutCancel(r.Context())
+
+			if rw.status == 0 {
+				rw.status = http.StatusOK
+			}
+
+			if !remembered(rw.status) {
+				err = store.Abort(ctx, key)
+			} else {
+				err = store.Complete(ctx, key, idempotency.Result{
+					Status:      rw.status,
+					ContentType: w.Header().Get("Content-Type"),
+					Body:        rw.body.Bytes(),
+				})
+			}
+
+			if err != nil {
+				slog.Error("failed to save idempotency key", "error", err)
+			}
+		})
+	}
+}
+
+func remembered(status int) bool {
+	return status < http.StatusInternalServerError &&
+		status != http.StatusUnauthorized &&
+		status != http.StatusForbidden
+}
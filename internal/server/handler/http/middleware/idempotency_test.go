@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+
+	handler := Idempotency(memory.NewIdempotencyStore(time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"delta":1}`))
+	}))
+
+	do := func(key string, token ...auth.Token) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+		if key != "" {
+			req.Header.Set(idempotency.Header, key)
+		}
+
+		for _, t := range token {
+			req = req.WithContext(auth.WithToken(req.Context(), t))
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("without key", func(t *testing.T) {
+		calls = 0
+
+		do("")
+		do("")
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("duplicate is replayed", func(t *testing.T) {
+		calls = 0
+
+		first := do("batch-1")
+		second := do("batch-1")
+
+		assert.Equal(t, 1, calls)
+		require.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+	})
+
+	t.Run("server error is not remembered", func(t *testing.T) {
+		calls = 0
+		status = http.StatusInternalServerError
+
+		do("batch-2")
+
+		status = http.StatusOK
+
+		res := do("batch-2")
+
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("refusals are not remembered", func(t *testing.T) {
+		for _, refused := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+			calls = 0
+			status = refused
+
+			key := "batch-4-" + strconv.Itoa(refused)
+
+			do(key)
+
+			status = http.StatusOK
+
+			res := do(key)
+
+			assert.Equal(t, 2, calls)
+			assert.Equal(t, http.StatusOK, res.Code)
+		}
+	})
+
+	t.Run("keys are scoped to the token", func(t *testing.T) {
+		calls = 0
+
+		do("batch-5", auth.Token{ID: "first"})
+		do("batch-5", auth.Token{ID: "first"})
+		do("batch-5", auth.Token{ID: "second"})
+		do("batch-5", auth.Token{})
+
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		store := memory.NewIdempotencyStore(time.Minute)
+
+		_, err := store.Begin(context.Background(), "/update/ batch-3")
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+		req.Header.Set(idempotency.Header, "batch-3")
+
+		rec := httptest.NewRecorder()
+
+		Idempotency(store)(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"conflict"`)
+	})
+}
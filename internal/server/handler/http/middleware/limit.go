@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type rateLimiter interface {
+	Allow(client string) (bool, time.Duration)
+}
+
+// RateLimit rejects requests of clients that exceed their rate with 429
+// and a Retry-After telling when to come back. A client is the token put
+// into the context by Authenticate, which must run first, or its remote
+// address. Nothing the client merely claims is trusted, so it can not
+// get a fresh bucket by sending another header.
+func RateLimit(limiter rateLimiter) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait := limiter.Allow(rateClient(r))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				response.Error(w, response.ErrTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateClient(r *http.Request) string {
+	if token, ok := auth.FromContext(r.Context()); ok && token.ID != "" {
+		return "token " + token.ID
+	}
+
+	// X-Real-IP is not used: a client could dodge its limit by changing it
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip " + host
+}
+
+// LimitBody fails reads of request bodies beyond n bytes, which is
+// answered with 413. Installed after GzipDecompress it bounds the
+// inflated body, not only what was sent over the wire.
+func LimitBody(n int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
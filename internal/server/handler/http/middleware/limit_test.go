@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/baisalov/metricollector/internal/server/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	handler := RateLimit(ratelimit.NewLimiter(0.001, 1))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(remoteAddr string, token *auth.Token, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+
+		if token != nil {
+			req = req.WithContext(auth.WithToken(req.Context(), *token))
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	clients := []struct {
+		name  string
+		addr  string
+		token *auth.Token
+	}{
+		{"address", "10.0.0.1", nil},
+		{"anonymous", "10.0.0.2", &auth.Token{}},
+		{"token", "10.0.0.3", &auth.Token{ID: "first"}},
+		{"other token", "10.0.0.3", &auth.Token{ID: "second"}},
+	}
+
+	for _, c := range clients {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, do(c.addr+":1000", c.token, nil).Code)
+
+			// a new port is the same client
+			rec := do(c.addr+":2000", c.token, nil)
+
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.Equal(t, "1000", rec.Header().Get("Retry-After"))
+			assert.Contains(t, rec.Body.String(), `"rate_limited"`)
+		})
+	}
+
+	t.Run("unverified headers do not make a new client", func(t *testing.T) {
+		header := http.Header{
+			"Authorization": {"Bearer mc_forged"},
+			"X-Agent-Id":    {"host-1"},
+			"X-Real-Ip":     {"10.9.9.9"},
+		}
+
+		assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.1:3000", nil, header).Code)
+	})
+
+	assert.Equal(t, http.StatusOK, do("10.0.0.4:1000", nil, nil).Code)
+}
+
+func TestLimitBody(t *testing.T) {
+	handler := LimitBody(1024)(GzipDecompress(LimitBody(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v any
+
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			response.Error(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))))
+
+	compress := func(data string) []byte {
+		var buf bytes.Buffer
+
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+
+		return buf.Bytes()
+	}
+
+	bomb := compress(`"` + strings.Repeat("a", 1<<18) + `"`)
+	require.Less(t, len(bomb), 1024, "the compressed body fits the limit")
+
+	tests := []struct {
+		name   string
+		body   []byte
+		gzip   bool
+		status int
+	}{
+		{"small", []byte(`{"id":"x"}`), false, http.StatusOK},
+		{"small compressed", compress(`{"id":"x"}`), true, http.StatusOK},
+		{"large", []byte(`"` + strings.Repeat("a", 2048) + `"`), false, http.StatusRequestEntityTooLarge},
+		{"inflates beyond the limit", bomb, true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+
+			if tt.gzip {
+				req.Header.Set(_contentEncoding, "gzip")
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+
+			if tt.status == http.StatusRequestEntityTooLarge {
+				assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
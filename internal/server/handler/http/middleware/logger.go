@@ -29,6 +29,11 @@ func (w loggingResponseWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func RequestLogging(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 
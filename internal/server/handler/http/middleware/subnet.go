@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIPHeader carries the address of the agent on its outbound
+// interface, which is what the trusted subnets are matched against.
+const RealIPHeader = "X-Real-IP"
+
+type untrustedKey struct{}
+
+// TrustedSubnets marks requests coming from outside subnets as
+// untrusted, so that Authorize refuses them every scope but read. The
+// remote address must be inside subnets. When it is, e.g. a proxy of the
+// trusted network, RealIPHeader names the client and must be inside them
+// too. The header of anyone else is ignored, as anyone can send it.
+func TrustedSubnets(subnets []netip.Prefix) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !trusted(subnets, r) {
+				r = r.WithContext(context.WithValue(r.Context(), untrustedKey{}, true))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func untrusted(ctx context.Context) bool {
+	v, _ := ctx.Value(untrustedKey{}).(bool)
+	return v
+}
+
+func trusted(subnets []netip.Prefix, r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !contains(subnets, host) {
+		return false
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get(RealIPHeader)); ip != "" {
+		return contains(subnets, ip)
+	}
+
+	return true
+}
+
+func contains(subnets []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, subnet := range subnets {
+		if subnet.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestTrustedSubnets(t *testing.T) {
+	subnets := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	write := TrustedSubnets(subnets)(Authorize(auth.ScopeWrite)(ok))
+	read := TrustedSubnets(subnets)(Authorize(auth.ScopeRead)(ok))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		write      int
+	}{
+		{"trusted real ip from a trusted proxy", "10.0.0.1:1234", "10.1.2.3", http.StatusOK},
+		{"trusted real ip from outside is ignored", "192.0.2.1:1234", "10.1.2.3", http.StatusForbidden},
+		{"untrusted real ip", "10.0.0.1:1234", "192.0.2.1", http.StatusForbidden},
+		{"trusted remote address", "10.0.0.1:1234", "", http.StatusOK},
+		{"untrusted remote address", "192.0.2.1:1234", "", http.StatusForbidden},
+		{"mapped ipv4", "10.0.0.1:1234", "::ffff:10.0.0.2", http.StatusOK},
+		{"mapped remote address", "[::ffff:10.0.0.1]:1234", "", http.StatusOK},
+		{"trusted ipv6", "[fd00::1]:1234", "fd12::1", http.StatusOK},
+		{"malformed real ip", "10.0.0.1:1234", "localhost", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			do := func(handler http.Handler) int {
+				req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+				req.RemoteAddr = tt.remoteAddr
+
+				if tt.realIP != "" {
+					req.Header.Set(RealIPHeader, tt.realIP)
+				}
+
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				return rec.Code
+			}
+
+			assert.Equal(t, tt.write, do(write))
+			assert.Equal(t, http.StatusOK, do(read))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package response
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"io"
+	"net/http"
+)
+
+// Code is a stable machine-readable error name returned to clients.
+type Code string
+
+const (
+	CodeEmptyBody          Code = "empty_body"
+	CodeInvalidJSON        Code = "invalid_json"
+	CodeInvalidType        Code = "invalid_type"
+	CodeEmptyID            Code = "empty_id"
+	CodeInvalidValue       Code = "invalid_value"
+	CodeNotFound           Code = "not_found"
+	CodeNotAcceptable      Code = "not_acceptable"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeForbidden          Code = "forbidden"
+	CodeInvalidScope       Code = "invalid_scope"
+	CodeInvalidSignature   Code = "invalid_signature"
+	CodeInvalidEncryption  Code = "invalid_encryption"
+	CodeInvalidEncoding    Code = "invalid_encoding"
+	CodeConflict           Code = "conflict"
+	CodeBodyTooLarge       Code = "body_too_large"
+	CodeBatchTooLarge      Code = "batch_too_large"
+	CodeRateLimited        Code = "rate_limited"
+	CodeStorageUnavailable Code = "storage_unavailable"
+	CodeInternal           Code = "internal_error"
+)
+
+// APIError is an error that is safe to show to clients as is.
+type APIError struct {
+	Code    Code
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrEmptyBody         = &APIError{CodeEmptyBody, http.StatusBadRequest, "empty request body"}
+	ErrInvalidJSON       = &APIError{CodeInvalidJSON, http.StatusBadRequest, "failed to decode request"}
+	ErrNotAcceptable     = &APIError{CodeNotAcceptable, http.StatusNotAcceptable, "content type must be application/json"}
+	ErrInvalidSignature  = &APIError{CodeInvalidSignature, http.StatusBadRequest, "missing or invalid body signature"}
+	ErrInvalidEncryption = &APIError{CodeInvalidEncryption, http.StatusBadRequest, "request body can not be decrypted"}
+	ErrInvalidEncoding   = &APIError{CodeInvalidEncoding, http.StatusBadRequest, "request body is not valid gzip"}
+	ErrUntrustedNetwork  = &APIError{CodeForbidden, http.StatusForbidden, "not allowed from this network"}
+	ErrBodyTooLarge      = &APIError{CodeBodyTooLarge, http.StatusRequestEntityTooLarge, "request body is too large"}
+	ErrBatchTooLarge     = &APIError{CodeBatchTooLarge, http.StatusRequestEntityTooLarge, "too many metrics in batch"}
+	ErrTooManyRequests   = &APIError{CodeRateLimited, http.StatusTooManyRequests, "too many requests"}
+	ErrInternal          = &APIError{CodeInternal, http.StatusInternalServerError, "internal server error"}
+)
+
+// catalog maps domain errors to their client representation.
+var catalog = []struct {
+	err error
+	api *APIError
+}{
+	{metric.ErrIncorrectType, &APIError{CodeInvalidType, http.StatusBadRequest, metric.ErrIncorrectType.Error()}},
+	{metric.ErrEmptyID, &APIError{CodeEmptyID, http.StatusBadRequest, metric.ErrEmptyID.Error()}},
+	{metric.ErrIncorrectValue, &APIError{CodeInvalidValue, http.StatusBadRequest, metric.ErrIncorrectValue.Error()}},
+	{metric.ErrMetricNotFound, &APIError{CodeNotFound, http.StatusNotFound, metric.ErrMetricNotFound.Error()}},
+	{auth.ErrUnauthorized, &APIError{CodeUnauthorized, http.StatusUnauthorized, auth.ErrUnauthorized.Error()}},
+	{auth.ErrForbidden, &APIError{CodeForbidden, http.StatusForbidden, auth.ErrForbidden.Error()}},
+	{auth.ErrTokenNotFound, &APIError{CodeNotFound, http.StatusNotFound, auth.ErrTokenNotFound.Error()}},
+	{auth.ErrInvalidScope, &APIError{CodeInvalidScope, http.StatusBadRequest, auth.ErrInvalidScope.Error()}},
+	{idempotency.ErrInProgress, &APIError{CodeConflict, http.StatusConflict, idempotency.ErrInProgress.Error()}},
+	{gzip.ErrHeader, ErrInvalidEncoding},
+	{gzip.ErrChecksum, ErrInvalidEncoding},
+	{metric.ErrStorageUnavailable, &APIError{CodeStorageUnavailable, http.StatusServiceUnavailable, metric.ErrStorageUnavailable.Error()}},
+}
+
+// Classify finds the client representation of err. Unknown errors are
+// reported as internal without leaking their text.
+func Classify(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	for _, c := range catalog {
+		if errors.Is(err, c.err) {
+			return c.api
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return ErrBodyTooLarge
+	}
+
+	var corrupt flate.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return ErrInvalidEncoding
+	}
+
+	if errors.Is(err, io.EOF) {
+		return ErrEmptyBody
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrInvalidJSON
+	}
+
+	return ErrInternal
+}
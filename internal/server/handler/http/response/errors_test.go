@@ -0,0 +1,74 @@
+package response
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   Code
+		status int
+	}{
+		{"api error", ErrNotAcceptable, CodeNotAcceptable, http.StatusNotAcceptable},
+		{"incorrect type", metric.ErrIncorrectType, CodeInvalidType, http.StatusBadRequest},
+		{"empty id", metric.ErrEmptyID, CodeEmptyID, http.StatusBadRequest},
+		{"wrapped incorrect value", fmt.Errorf("%w: nope", metric.ErrIncorrectValue), CodeInvalidValue, http.StatusBadRequest},
+		{"not found", metric.ErrMetricNotFound, CodeNotFound, http.StatusNotFound},
+		{"unauthorized", auth.ErrUnauthorized, CodeUnauthorized, http.StatusUnauthorized},
+		{"forbidden", auth.ErrForbidden, CodeForbidden, http.StatusForbidden},
+		{"invalid scope", fmt.Errorf("%w: \"root\"", auth.ErrInvalidScope), CodeInvalidScope, http.StatusBadRequest},
+		{"storage unavailable", fmt.Errorf("can not save metric: %w", metric.ErrStorageUnavailable), CodeStorageUnavailable, http.StatusServiceUnavailable},
+		{"in progress", idempotency.ErrInProgress, CodeConflict, http.StatusConflict},
+		{"bad gzip header", gzip.ErrHeader, CodeInvalidEncoding, http.StatusBadRequest},
+		{"corrupt deflate", fmt.Errorf("read body: %w", flate.CorruptInputError(3)), CodeInvalidEncoding, http.StatusBadRequest},
+		{"empty body", io.EOF, CodeEmptyBody, http.StatusBadRequest},
+		{"truncated json", io.ErrUnexpectedEOF, CodeInvalidJSON, http.StatusBadRequest},
+		{"syntax", &json.SyntaxError{}, CodeInvalidJSON, http.StatusBadRequest},
+		{"unknown", errors.New("pq: relation does not exist"), CodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := Classify(tt.err)
+
+			assert.Equal(t, tt.code, apiErr.Code)
+			assert.Equal(t, tt.status, apiErr.Status)
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	Error(rec, errors.New("secret details"))
+
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"Status":500,"Code":"internal_error","Error":"internal server error"}`, rec.Body.String())
+}
+
+func TestError_TooLarge(t *testing.T) {
+	for _, err := range []error{ErrBodyTooLarge, ErrBatchTooLarge, &http.MaxBytesError{Limit: 1}} {
+		rec := httptest.NewRecorder()
+
+		Error(rec, err)
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,41 @@
+package response
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"text/html", "application/json", "text/csv", "text/plain"}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"no header", "", "text/html"},
+		{"anything", "*/*", "text/html"},
+		{"exact", "application/json", "application/json"},
+		{"case and spaces", " Text/CSV ", "text/csv"},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"prometheus", "application/openmetrics-text;version=1.0.0;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1", "text/plain"},
+		{"quality wins over order", "text/html;q=0.2, application/json", "application/json"},
+		{"subtype wildcard", "text/*;q=0.5, text/csv", "text/csv"},
+		{"specific range overrides wildcard", "text/*, text/html;q=0", "text/csv"},
+		{"nothing acceptable", "image/png", ""},
+		{"refused explicitly", "application/json;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			assert.Equal(t, tt.want, Negotiate(r, offers...))
+		})
+	}
+}
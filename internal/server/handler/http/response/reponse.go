@@ -4,17 +4,37 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"strconv"
 )
 
+// retryTooLarge is the Retry-After in seconds sent with 413. The request
+// will not pass as it is, so clients are told to back off instead of
+// resending it at once.
+const retryTooLarge = 60
+
 type errorResponse struct {
 	Status int
+	Code   Code
 	Error  string
 }
 
-func Error(w http.ResponseWriter, message string, status int) {
-	w.WriteHeader(status)
+// Error writes the catalogued representation of err. Errors that end
+// up as 5xx are logged with their original text.
+func Error(w http.ResponseWriter, err error) {
+	apiErr := Classify(err)
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		slog.Error("request failed", "error", err)
+	}
+
+	if apiErr.Status == http.StatusRequestEntityTooLarge {
+		w.Header().Set("Retry-After", strconv.Itoa(retryTooLarge))
+	}
 
-	writeBody(w, errorResponse{status, message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+
+	writeBody(w, errorResponse{apiErr.Status, apiErr.Code, apiErr.Message})
 }
 
 type successResponse struct {
@@ -23,6 +43,7 @@ type successResponse struct {
 }
 
 func Ok(w http.ResponseWriter) {
+	setContentType(w)
 	w.WriteHeader(http.StatusOK)
 
 	writeBody(w, successResponse{http.StatusOK, "OK"})
@@ -35,11 +56,18 @@ func Success(w http.ResponseWriter, body any) {
 		return
 	}
 
+	setContentType(w)
 	w.WriteHeader(http.StatusOK)
 
 	writeBody(w, body)
 }
 
+func setContentType(w http.ResponseWriter) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+}
+
 func writeBody(w http.ResponseWriter, body any) {
 	if err := json.NewEncoder(w).Encode(body); err != nil {
 		slog.Error("failed to write response body", "error", err)
@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AdminHandler struct {
+	backuper backuper
+}
+
+type backuper interface {
+	Backup(ctx context.Context, start func(size int64) io.Writer) error
+}
+
+func NewAdminHandler(backuper backuper) *AdminHandler {
+	return &AdminHandler{backuper: backuper}
+}
+
+func (h *AdminHandler) Register(router chi.Router) {
+	router.With(middleware.Authorize(auth.ScopeAdmin)).Get(`/admin/backup`, h.Backup)
+}
+
+func (h *AdminHandler) Backup(w http.ResponseWriter, r *http.Request) {
+	started := false
+
+	// a large database takes longer to send than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to reset write deadline", "error", err)
+	}
+
+	// the length is announced, so a backup that fails halfway ends with
+	// a cut connection instead of passing for a complete one
+	err := h.backuper.Backup(r.Context(), func(size int64) io.Writer {
+		started = true
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="metrics.db"`)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+
+		w.WriteHeader(http.StatusOK)
+
+		return w
+	})
+
+	if err != nil && !started {
+		response.Error(w, err)
+		return
+	}
+
+	if err != nil {
+		slog.Error("failed to write backup", "error", err)
+	}
+}
@@ -0,0 +1,79 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type backuperMock struct {
+	data string
+	// size is announced before data is written, len(data) by default
+	size int64
+	// err is returned after data is written, or before it when started
+	// is false
+	err     error
+	started bool
+}
+
+func (b backuperMock) Backup(_ context.Context, start func(size int64) io.Writer) error {
+	if b.err != nil && !b.started {
+		return b.err
+	}
+
+	size := b.size
+	if size == 0 {
+		size = int64(len(b.data))
+	}
+
+	if _, err := io.WriteString(start(size), b.data); err != nil {
+		return err
+	}
+
+	return b.err
+}
+
+func TestAdminHandler_Backup(t *testing.T) {
+	serve := func(backuper backuperMock) *httptest.ResponseRecorder {
+		router := chi.NewMux()
+
+		NewAdminHandler(backuper).Register(router)
+
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/backup", nil))
+
+		return recorder
+	}
+
+	t.Run("success", func(t *testing.T) {
+		recorder := serve(backuperMock{data: "snapshot"})
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/octet-stream", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "8", recorder.Header().Get("Content-Length"))
+		assert.Equal(t, "snapshot", recorder.Body.String())
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		recorder := serve(backuperMock{data: "snap", size: 8, err: errors.New("broken"), started: true})
+
+		// the status is already sent, the short body tells the failure
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "8", recorder.Header().Get("Content-Length"))
+		assert.Less(t, recorder.Body.Len(), 8)
+	})
+
+	t.Run("failure before start", func(t *testing.T) {
+		recorder := serve(backuperMock{err: errors.New("broken")})
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	})
+}
@@ -0,0 +1,124 @@
+package v1
+
+import (
+	"embed"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/go-chi/chi/v5"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dashboardRefresh is how often the dashboard page reloads the metrics.
+const dashboardRefresh = 10 * time.Second
+
+//go:embed dashboard
+var dashboardFS embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(dashboardFS, "dashboard/index.html"))
+
+type DashboardHandler struct {
+	provider metricProvider
+	static   http.Handler
+}
+
+func NewDashboardHandler(provider metricProvider) *DashboardHandler {
+	root, err := fs.Sub(dashboardFS, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+
+	return &DashboardHandler{
+		provider: provider,
+		static:   http.StripPrefix(`/dashboard/`, http.FileServer(http.FS(root))),
+	}
+}
+
+// Register adds the dashboard routes. With authentication on, browsers
+// sign in on the login page, which keeps the token in a cookie that
+// Authenticate reads on page loads and the page script's requests.
+func (h *DashboardHandler) Register(router chi.Router) {
+	router.Get(`/dashboard`, http.RedirectHandler(`/dashboard/`, http.StatusMovedPermanently).ServeHTTP)
+	router.With(requireLogin, middleware.Authorize(auth.ScopeRead)).Get(`/dashboard/`, h.Index)
+	router.Get(`/dashboard/login`, h.Login)
+	router.Get(`/dashboard/static/*`, h.static.ServeHTTP)
+}
+
+// Login serves the page that asks for a token.
+func (h *DashboardHandler) Login(w http.ResponseWriter, r *http.Request) {
+	http.ServeFileFS(w, r, dashboardFS, "dashboard/login.html")
+}
+
+// requireLogin sends anonymous browsers to the login page instead of
+// showing them a JSON error.
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := auth.FromContext(r.Context()); ok && token.ID == "" {
+			http.Redirect(w, r, `/dashboard/login`, http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type metricGroup struct {
+	Type    metric.Type
+	Metrics []metric.Metric
+}
+
+type dashboardPage struct {
+	Groups  []metricGroup
+	Refresh int64
+}
+
+// Index renders the current metrics grouped by type. The page script
+// keeps it up to date and draws sparklines from the values it has seen.
+func (h *DashboardHandler) Index(w http.ResponseWriter, r *http.Request) {
+	res, err := h.provider.All(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	page := dashboardPage{
+		Groups:  groupByType(res),
+		Refresh: dashboardRefresh.Milliseconds(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	w.WriteHeader(http.StatusOK)
+
+	if err = dashboardTemplate.ExecuteTemplate(w, "index.html", page); err != nil {
+		slog.Error("Failed to render dashboard", "error", err)
+	}
+}
+
+// groupByType returns gauges first, then counters, each sorted by id.
+func groupByType(metrics []metric.Metric) []metricGroup {
+	groups := []metricGroup{{Type: metric.Gauge}, {Type: metric.Counter}}
+
+	for _, m := range metrics {
+		for i := range groups {
+			if groups[i].Type == m.MType {
+				groups[i].Metrics = append(groups[i].Metrics, m)
+			}
+		}
+	}
+
+	for _, g := range groups {
+		slices.SortFunc(g.Metrics, func(a, b metric.Metric) int {
+			return strings.Compare(a.ID, b.ID)
+		})
+	}
+
+	return groups
+}
@@ -0,0 +1,133 @@
+'use strict';
+
+(function () {
+    // samples kept per metric for the sparklines
+    const historySize = 60;
+
+    const refresh = Number(document.body.dataset.refresh) || 10000;
+    const search = document.getElementById('search');
+    const updated = document.getElementById('updated');
+    const history = new Map();
+
+    function key(type, id) {
+        return type + '/' + id;
+    }
+
+    function value(m) {
+        return m.type === 'counter' ? m.delta : m.value;
+    }
+
+    function remember(type, id, v) {
+        const k = key(type, id);
+        const points = history.get(k) || [];
+
+        points.push(v);
+        if (points.length > historySize) {
+            points.shift();
+        }
+
+        history.set(k, points);
+
+        return points;
+    }
+
+    function sparkline(svg, points) {
+        svg.replaceChildren();
+
+        if (points.length < 2) {
+            return;
+        }
+
+        const min = Math.min(...points);
+        const max = Math.max(...points);
+        const span = max - min || 1;
+        const step = 100 / (points.length - 1);
+
+        const line = document.createElementNS('http://www.w3.org/2000/svg', 'polyline');
+        line.setAttribute('points', points.map((p, i) =>
+            (i * step).toFixed(2) + ',' + (19 - (p - min) / span * 18).toFixed(2)).join(' '));
+
+        svg.appendChild(line);
+    }
+
+    function row(m) {
+        const tr = document.createElement('tr');
+        tr.dataset.id = m.id;
+
+        const id = document.createElement('td');
+        id.className = 'id';
+        id.textContent = m.id;
+
+        const v = document.createElement('td');
+        v.className = 'value';
+
+        const trend = document.createElement('td');
+        trend.className = 'trend';
+
+        const svg = document.createElementNS('http://www.w3.org/2000/svg', 'svg');
+        svg.setAttribute('class', 'sparkline');
+        svg.setAttribute('viewBox', '0 0 100 20');
+        svg.setAttribute('preserveAspectRatio', 'none');
+        trend.appendChild(svg);
+
+        tr.append(id, v, trend);
+
+        return tr;
+    }
+
+    function insert(tbody, tr) {
+        const next = Array.from(tbody.rows).find(r => r.dataset.id > tr.dataset.id);
+        tbody.insertBefore(tr, next || null);
+    }
+
+    function render(metrics) {
+        for (const m of metrics) {
+            const tbody = document.querySelector('.group[data-type="' + m.type + '"] tbody');
+            if (!tbody) {
+                continue;
+            }
+
+            let tr = Array.from(tbody.rows).find(r => r.dataset.id === m.id);
+            if (!tr) {
+                tr = row(m);
+                insert(tbody, tr);
+            }
+
+            tr.querySelector('.value').textContent = String(value(m));
+            sparkline(tr.querySelector('.sparkline'), remember(m.type, m.id, value(m)));
+        }
+
+        filter();
+
+        updated.textContent = 'Updated ' + new Date().toLocaleTimeString();
+    }
+
+    function filter() {
+        const q = search.value.trim().toLowerCase();
+
+        for (const tr of document.querySelectorAll('tbody tr')) {
+            tr.classList.toggle('hidden', q !== '' && !tr.dataset.id.toLowerCase().includes(q));
+        }
+    }
+
+    async function load() {
+        try {
+            const res = await fetch('/api/v2/metrics', {headers: {Accept: 'application/json'}, credentials: 'same-origin'});
+            if (res.status === 401) {
+                location.href = 'login';
+                return;
+            }
+            if (res.ok) {
+                render(await res.json());
+            }
+        } catch (e) {
+            updated.textContent = 'Update failed';
+        } finally {
+            setTimeout(load, refresh);
+        }
+    }
+
+    search.addEventListener('input', filter);
+
+    load();
+})();
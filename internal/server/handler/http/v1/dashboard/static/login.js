@@ -0,0 +1,18 @@
+'use strict';
+
+(function () {
+    // the server reads the token from this cookie on page loads, which can
+    // not carry a bearer header; keep the name in sync with TokenCookie
+    const cookie = 'metricollector_token';
+
+    document.getElementById('login').addEventListener('submit', function (e) {
+        e.preventDefault();
+
+        const token = document.getElementById('token').value.trim();
+        const secure = location.protocol === 'https:' ? '; Secure' : '';
+
+        document.cookie = cookie + '=' + encodeURIComponent(token) + '; Path=/; SameSite=Strict' + secure;
+
+        location.href = './';
+    });
+})();
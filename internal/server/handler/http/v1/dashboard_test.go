@@ -0,0 +1,145 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardHandler(t *testing.T) {
+	serve := func(storage *metricStorageMock, path string) *httptest.ResponseRecorder {
+		router := chi.NewMux()
+
+		NewDashboardHandler(storage).Register(router)
+
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return recorder
+	}
+
+	t.Run("index groups metrics by type", func(t *testing.T) {
+		storage := new(metricStorageMock)
+		storage.On("All", mock.Anything).Return(
+			metric.NewCounterMetric("requests", 3),
+			metric.NewGaugeMetric("memory", 1.5),
+			metric.NewGaugeMetric("cpu", 0.25),
+			metric.NewGaugeMetric("load", 10),
+			metric.NewGaugeMetric("idle", 0),
+			nil,
+		)
+
+		recorder := serve(storage, "/dashboard/")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+
+		body := recorder.Body.String()
+
+		gauges := strings.Index(body, `data-type="gauge"`)
+		counters := strings.Index(body, `data-type="counter"`)
+		cpu := strings.Index(body, `data-id="cpu"`)
+		mem := strings.Index(body, `data-id="memory"`)
+		req := strings.Index(body, `data-id="requests"`)
+
+		assert.True(t, gauges < cpu && cpu < mem && mem < counters && counters < req, "unexpected order:\n%s", body)
+		assert.Contains(t, body, `<td class="value">1.5</td>`)
+		assert.Contains(t, body, `<td class="value">3</td>`)
+		assert.Contains(t, body, `<td class="value">10</td>`)
+		assert.Contains(t, body, `<td class="value">0</td>`)
+	})
+
+	t.Run("index escapes metric ids", func(t *testing.T) {
+		storage := new(metricStorageMock)
+		storage.On("All", mock.Anything).Return(metric.NewGaugeMetric("<script>alert(1)</script>", 1), nil)
+
+		body := serve(storage, "/dashboard/").Body.String()
+
+		assert.NotContains(t, body, "<script>alert(1)</script>")
+		assert.Contains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	})
+
+	t.Run("index storage failure", func(t *testing.T) {
+		storage := new(metricStorageMock)
+		storage.On("All", mock.Anything).Return(errors.New("broken"))
+
+		assert.Equal(t, http.StatusInternalServerError, serve(storage, "/dashboard/").Code)
+	})
+
+	t.Run("static assets", func(t *testing.T) {
+		recorder := serve(new(metricStorageMock), "/dashboard/static/app.js")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Header().Get("Content-Type"), "javascript")
+		assert.Contains(t, recorder.Body.String(), "/api/v2/metrics")
+
+		assert.Equal(t, http.StatusNotFound, serve(new(metricStorageMock), "/dashboard/static/missing.js").Code)
+	})
+
+	t.Run("redirect to index", func(t *testing.T) {
+		recorder := serve(new(metricStorageMock), "/dashboard")
+
+		assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+		assert.Equal(t, "/dashboard/", recorder.Header().Get("Location"))
+	})
+
+	t.Run("login with auth", func(t *testing.T) {
+		tokens, err := memory.NewTokenStore("")
+		require.NoError(t, err)
+
+		token, secret, err := auth.Issue("browser", []auth.Scope{auth.ScopeRead})
+		require.NoError(t, err)
+		require.NoError(t, tokens.Create(context.Background(), token))
+
+		storage := new(metricStorageMock)
+		storage.On("All", mock.Anything).Return(metric.NewGaugeMetric("cpu", 0.25), nil)
+
+		router := chi.NewMux()
+		router.Use(middleware.Authenticate(tokens))
+
+		NewDashboardHandler(storage).Register(router)
+
+		get := func(path, cookie string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if cookie != "" {
+				req.AddCookie(&http.Cookie{Name: middleware.TokenCookie, Value: cookie})
+			}
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			return recorder
+		}
+
+		anonymous := get("/dashboard/", "")
+		assert.Equal(t, http.StatusSeeOther, anonymous.Code)
+		assert.Equal(t, "/dashboard/login", anonymous.Header().Get("Location"))
+
+		login := get("/dashboard/login", "")
+		require.Equal(t, http.StatusOK, login.Code)
+		assert.Contains(t, login.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, login.Body.String(), "static/login.js")
+
+		script := get("/dashboard/static/login.js", "")
+		require.Equal(t, http.StatusOK, script.Code)
+		assert.Contains(t, script.Body.String(), middleware.TokenCookie)
+
+		assert.Equal(t, http.StatusSeeOther, get("/dashboard/", "mc_unknown").Code)
+
+		signed := get("/dashboard/", secret)
+		require.Equal(t, http.StatusOK, signed.Code)
+		assert.Contains(t, signed.Body.String(), `data-id="cpu"`)
+	})
+}
@@ -3,6 +3,7 @@ package v1
 import (
 	"context"
 	"errors"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
 	"github.com/go-chi/chi/v5"
 	"log/slog"
 	"net/http"
@@ -26,8 +27,8 @@ func (h *HealthCheckHandler) Register(mux *chi.Mux) {
 
 func (h *HealthCheckHandler) Check(w http.ResponseWriter, r *http.Request) {
 	if err := h.ch.Check(r.Context()); err != nil && !errors.Is(err, context.Canceled) {
-		slog.Error(err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.Error("health check failed", "error", err)
+		response.Error(w, err)
 		return
 	}
 
@@ -84,7 +84,7 @@ func TestHealthCheckHandler_Check_NoError(t *testing.T) {
 func TestHealthCheckHandler_Check_WithError(t *testing.T) {
 	mock := &mockChecker{
 		checkFunc: func(ctx context.Context) error {
-			return errors.New("internal error")
+			return errors.New("connection refused")
 		},
 	}
 	h := NewHealthCheckHandler(mock)
@@ -98,8 +98,12 @@ func TestHealthCheckHandler_Check_WithError(t *testing.T) {
 		t.Fatalf("expected status code %v, got %v", http.StatusInternalServerError, recorder.Code)
 	}
 
-	if !strings.Contains(recorder.Body.String(), "internal error") {
-		t.Fatalf("expected error message in response body, got %v", recorder.Body.String())
+	if !strings.Contains(recorder.Body.String(), "internal_error") {
+		t.Fatalf("expected error code in response body, got %v", recorder.Body.String())
+	}
+
+	if strings.Contains(recorder.Body.String(), "connection refused") {
+		t.Fatalf("expected error text to be hidden, got %v", recorder.Body.String())
 	}
 }
 
@@ -1,11 +1,12 @@
 package v1
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
 	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
 	"github.com/baisalov/metricollector/internal/server/handler/http/response"
 	"github.com/go-chi/chi/v5"
@@ -16,14 +17,10 @@ import (
 	"strings"
 )
 
-const (
-	errFailedToDecodeRequest = "failed to decode request"
-	errEmptyRequestBody      = "empty request body"
-)
-
 type MetricHandler struct {
 	provider metricProvider
 	updater  metricUpdater
+	maxBatch int
 }
 
 type metricUpdater interface {
@@ -43,47 +40,60 @@ func NewMetricHandler(provider metricProvider, updater metricUpdater) *MetricHan
 	}
 }
 
+// WithMaxBatch makes the handler reject batches of more than n metrics
+// with 413. Batches are not limited when n is zero.
+func (h *MetricHandler) WithMaxBatch(n int) *MetricHandler {
+	h.maxBatch = n
+	return h
+}
+
+func (h *MetricHandler) batchTooLarge(n int) bool {
+	return h.maxBatch > 0 && n > h.maxBatch
+}
+
 func (h *MetricHandler) Register(router chi.Router) {
 
+	read := middleware.Authorize(auth.ScopeRead)
+	write := middleware.Authorize(auth.ScopeWrite)
+
 	router.Route(`/update/`, func(r chi.Router) {
-		r.Post(`/{type}/{name}/{value}`, h.Update)
+		r.With(write).Post(`/{type}/{name}/{value}`, h.Update)
 	})
 
-	router.Get(`/value/{type}/{name}`, h.Value)
-	router.Get(`/`, h.AllValues)
+	router.With(read).Get(`/value/{type}/{name}`, h.Value)
+	router.With(read).Get(`/`, h.AllValues)
 
-	router.With(middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/updates/`, http.HandlerFunc(h.Updates))
-	router.With(middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/update/`, http.HandlerFunc(h.UpdateV2))
-	router.With(middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/value/`, http.HandlerFunc(h.ValueV2))
-	router.With(middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/`, http.HandlerFunc(h.AllValuesV2))
+	router.With(write, middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/updates/`, http.HandlerFunc(h.Updates))
+	router.With(write, middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/update/`, http.HandlerFunc(h.UpdateV2))
+	router.With(read, middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/value/`, http.HandlerFunc(h.ValueV2))
+	router.With(read, middleware.AcceptedContentTypeJSON).Method(http.MethodPost, `/`, http.HandlerFunc(h.AllValuesV2))
 }
 
 func (h *MetricHandler) Updates(w http.ResponseWriter, r *http.Request) {
 
+	if partial, _ := strconv.ParseBool(r.URL.Query().Get("partial")); partial {
+		h.updatesPartial(w, r)
+		return
+	}
+
 	decoder := json.NewDecoder(r.Body)
 
 	var metrics []metric.Metric
 
 	err := decoder.Decode(&metrics)
 	if err != nil {
-		if errors.Is(err, io.EOF) {
-			response.Error(w, errEmptyRequestBody, http.StatusBadRequest)
-			return
-		}
-
-		if errors.Is(err, metric.ErrIncorrectType) {
-			response.Error(w, metric.ErrIncorrectType.Error(), http.StatusBadRequest)
-			return
-		}
+		response.Error(w, err)
+		return
+	}
 
-		slog.Error(errFailedToDecodeRequest, "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+	if h.batchTooLarge(len(metrics)) {
+		response.Error(w, response.ErrBatchTooLarge)
 		return
 	}
 
 	for _, m := range metrics {
 		if err = m.Validate(); err != nil {
-			response.Error(w, err.Error(), http.StatusBadRequest)
+			response.Error(w, err)
 			return
 		}
 	}
@@ -92,38 +102,132 @@ func (h *MetricHandler) Updates(w http.ResponseWriter, r *http.Request) {
 
 	err = h.updater.Updates(r.Context(), metrics...)
 	if err != nil {
-		slog.Error("failed to update metrics", "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
 	response.Ok(w)
 }
 
-func (h *MetricHandler) UpdateV2(w http.ResponseWriter, r *http.Request) {
+const (
+	itemStatusAccepted = "accepted"
+	itemStatusRejected = "rejected"
+)
+
+type itemResult struct {
+	Index  int           `json:"index"`
+	ID     string        `json:"id,omitempty"`
+	Status string        `json:"status"`
+	Code   response.Code `json:"code,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type batchResult struct {
+	Accepted int          `json:"accepted"`
+	Rejected int          `json:"rejected"`
+	Results  []itemResult `json:"results"`
+}
+
+func (b *batchResult) reject(i int, err error) {
+	apiErr := response.Classify(err)
+
+	b.Rejected++
+	b.Results[i].Status = itemStatusRejected
+	b.Results[i].Code = apiErr.Code
+	b.Results[i].Error = apiErr.Message
+}
+
+// updatesPartial applies the valid metrics of a batch and reports the
+// outcome of every item, so the client can retry or drop only the bad
+// ones. The status is 200 when everything was accepted and 207 otherwise.
+func (h *MetricHandler) updatesPartial(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
 
-	var request metric.Metric
+	var items []json.RawMessage
 
-	if err := decoder.Decode(&request); err != nil {
-		if errors.Is(err, io.EOF) {
-			response.Error(w, errEmptyRequestBody, http.StatusBadRequest)
-			return
+	err := decoder.Decode(&items)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	if h.batchTooLarge(len(items)) {
+		response.Error(w, response.ErrBatchTooLarge)
+		return
+	}
+
+	result := batchResult{Results: make([]itemResult, len(items))}
+
+	metrics := make([]metric.Metric, 0, len(items))
+	indexes := make([]int, 0, len(items))
+
+	for i, item := range items {
+		result.Results[i].Index = i
+
+		var m metric.Metric
+
+		err = json.Unmarshal(item, &m)
+		if err == nil {
+			err = m.Validate()
 		}
 
-		if errors.Is(err, metric.ErrIncorrectType) {
-			response.Error(w, metric.ErrIncorrectType.Error(), http.StatusBadRequest)
-			return
+		result.Results[i].ID = m.ID
+
+		if err != nil {
+			result.reject(i, err)
+			continue
+		}
+
+		metrics = append(metrics, m)
+		indexes = append(indexes, i)
+	}
+
+	slog.Debug("Update", "request", metrics)
+
+	if len(metrics) > 0 {
+		err = h.updater.Updates(r.Context(), metrics...)
+	}
+
+	for _, i := range indexes {
+		if err != nil {
+			result.reject(i, err)
+			continue
 		}
 
-		slog.Error(errFailedToDecodeRequest, "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+		result.Accepted++
+		result.Results[i].Status = itemStatusAccepted
+	}
+
+	if err != nil {
+		slog.Error("failed to update metrics", "error", err)
+	}
+
+	status := http.StatusOK
+	if result.Rejected > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	w.WriteHeader(status)
+
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		slog.Error("failed to write response body", "error", err)
+	}
+}
+
+func (h *MetricHandler) UpdateV2(w http.ResponseWriter, r *http.Request) {
+
+	decoder := json.NewDecoder(r.Body)
+
+	var request metric.Metric
+
+	if err := decoder.Decode(&request); err != nil {
+		response.Error(w, err)
 		return
 	}
 
 	if err := request.Validate(); err != nil {
-		response.Error(w, err.Error(), http.StatusBadRequest)
+		response.Error(w, err)
 		return
 	}
 
@@ -131,8 +235,7 @@ func (h *MetricHandler) UpdateV2(w http.ResponseWriter, r *http.Request) {
 
 	res, err := h.updater.Update(r.Context(), request)
 	if err != nil {
-		slog.Error("failed to update metric", "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
@@ -146,36 +249,20 @@ func (h *MetricHandler) ValueV2(w http.ResponseWriter, r *http.Request) {
 	var req metric.Metric
 
 	if err := decoder.Decode(&req); err != nil {
-		if errors.Is(err, io.EOF) {
-			response.Error(w, errEmptyRequestBody, http.StatusBadRequest)
-			return
-		}
-
-		if errors.Is(err, metric.ErrIncorrectType) {
-			response.Error(w, metric.ErrIncorrectType.Error(), http.StatusBadRequest)
-			return
-		}
-
-		slog.Error(errFailedToDecodeRequest, "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
 	if strings.TrimSpace(req.ID) == "" {
-		response.Error(w, "empty metric name", http.StatusBadRequest)
+		response.Error(w, metric.ErrEmptyID)
+		return
 	}
 
 	slog.Debug("Value", "request", req)
 
 	res, err := h.provider.Get(r.Context(), req.MType, req.ID)
 	if err != nil {
-		if errors.Is(err, metric.ErrMetricNotFound) {
-			response.Error(w, "metric not found", http.StatusNotFound)
-			return
-		}
-
-		slog.Error("failed to get metric", "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
@@ -186,8 +273,7 @@ func (h *MetricHandler) AllValuesV2(w http.ResponseWriter, r *http.Request) {
 
 	res, err := h.provider.All(r.Context())
 	if err != nil {
-		slog.Error("failed to get metrics", "error", err)
-		response.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
@@ -206,7 +292,7 @@ func (h *MetricHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if m.MType == metric.Counter {
 		value, err := strconv.Atoi(metricValue)
 		if err != nil {
-			http.Error(w, "incorrect counter metric value", http.StatusBadRequest)
+			response.Error(w, fmt.Errorf("%w: counter must be an integer", metric.ErrIncorrectValue))
 			return
 		}
 
@@ -217,7 +303,7 @@ func (h *MetricHandler) Update(w http.ResponseWriter, r *http.Request) {
 	} else {
 		value, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
-			http.Error(w, "incorrect gauge metric value", http.StatusBadRequest)
+			response.Error(w, fmt.Errorf("%w: gauge must be a number", metric.ErrIncorrectValue))
 			return
 		}
 
@@ -225,14 +311,13 @@ func (h *MetricHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := m.Validate(); err != nil {
-		response.Error(w, err.Error(), http.StatusBadRequest)
+		response.Error(w, err)
 		return
 	}
 
 	_, err := h.updater.Update(r.Context(), m)
 	if err != nil {
-		slog.Error("failed to update metric", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
@@ -242,7 +327,7 @@ func (h *MetricHandler) Update(w http.ResponseWriter, r *http.Request) {
 func (h *MetricHandler) Value(w http.ResponseWriter, r *http.Request) {
 	metricType := metric.ParseType(r.PathValue("type"))
 	if !metricType.IsValid() {
-		w.WriteHeader(http.StatusBadRequest)
+		response.Error(w, metric.ErrIncorrectType)
 		return
 	}
 
@@ -250,13 +335,7 @@ func (h *MetricHandler) Value(w http.ResponseWriter, r *http.Request) {
 
 	m, err := h.provider.Get(r.Context(), metricType, metricName)
 	if err != nil {
-		if errors.Is(err, metric.ErrMetricNotFound) {
-			http.Error(w, "metric not found", http.StatusNotFound)
-			return
-		}
-
-		slog.Error("failed to get metric", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
@@ -270,48 +349,57 @@ func (h *MetricHandler) Value(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// AllValues lists all metrics as an HTML page, JSON, CSV or Prometheus
+// text, whichever the Accept header prefers.
 func (h *MetricHandler) AllValues(w http.ResponseWriter, r *http.Request) {
 
-	res, err := h.provider.All(r.Context())
-	if err != nil {
-		slog.Error("failed to get metrics", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	contentType := response.Negotiate(r, contentTypeHTML, contentTypeJSON, contentTypeCSV, contentTypePrometheus)
+	if contentType == "" {
+		response.Error(w, response.ErrNotAcceptable)
 		return
 	}
 
-	var body strings.Builder
-
-	_, err = body.WriteString("<html><head><title>Metrics</title></head><body><ol>")
+	res, err := h.provider.All(r.Context())
 	if err != nil {
-		slog.Error("failed to write content header", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err)
 		return
 	}
 
-	for _, m := range res {
+	w.Header().Add("Vary", "Accept")
 
-		_, err = fmt.Fprintf(&body, "<li>%s: %v</li>", m.ID, m.ValueToString())
-		if err != nil {
-			slog.Error("failed to write content body", "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	var render func(io.Writer, []metric.Metric) error
+
+	switch contentType {
+	case contentTypeJSON:
+		if res == nil {
+			res = []metric.Metric{}
 		}
 
+		response.Success(w, res)
+
+		return
+	case contentTypeCSV:
+		render = renderCSV
+	case contentTypePrometheus:
+		contentType += "; version=" + prometheusVersion + "; charset=utf-8"
+		render = renderPrometheus
+	default:
+		render = renderHTML
 	}
 
-	_, err = body.WriteString("</ol></body></html>")
-	if err != nil {
-		slog.Error("failed to write content bottom", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var body bytes.Buffer
+
+	if err = render(&body, res); err != nil {
+		response.Error(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Content-Type", contentType)
 
 	w.WriteHeader(http.StatusOK)
 
-	_, err = w.Write([]byte(body.String()))
+	_, err = w.Write(body.Bytes())
 	if err != nil {
-		slog.Error("Failed to write response body", err)
+		slog.Error("Failed to write response body", "error", err)
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/baisalov/metricollector/internal/metric"
 	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
 	"github.com/baisalov/metricollector/internal/server/service"
 	"github.com/baisalov/metricollector/internal/transactions"
 	"github.com/go-chi/chi/v5"
@@ -42,6 +43,11 @@ func (s *metricStorageMock) Save(ctx context.Context, m metric.Metric) error {
 	return args.Error(0)
 }
 
+func (s *metricStorageMock) Increment(ctx context.Context, id string, delta int64) (metric.Metric, error) {
+	args := s.Called(ctx, id, delta)
+	return args.Get(0).(metric.Metric), args.Error(1)
+}
+
 func (s *metricStorageMock) All(ctx context.Context) ([]metric.Metric, error) {
 	args := s.Called(ctx)
 
@@ -59,6 +65,21 @@ func (s *metricStorageMock) All(ctx context.Context) ([]metric.Metric, error) {
 	return metrics, args.Error(len(args) - 1)
 }
 
+func (s *metricStorageMock) Each(ctx context.Context, fn func(metric.Metric) error) error {
+	metrics, err := s.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		if err = fn(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func setupServer(storage *metricStorageMock) *httptest.Server {
 	router := chi.NewMux()
 
@@ -126,6 +147,8 @@ func TestMetricHandler_UpdateV2(t *testing.T) {
 	storage.On("Get", mock.Anything, mock.Anything, mock.MatchedBy(metricMatcher(existGauge.ID))).Return(existGauge, nil)
 	storage.On("Get", mock.Anything, mock.Anything, mock.MatchedBy(metricMatcher(newCounter.ID))).Return(metric.Metric{}, metric.ErrMetricNotFound)
 	storage.On("Get", mock.Anything, mock.Anything, mock.MatchedBy(metricMatcher(newGouge.ID))).Return(metric.Metric{}, metric.ErrMetricNotFound)
+	storage.On("Increment", mock.Anything, existCounter.ID, int64(10)).Return(metric.NewCounterMetric(existCounter.ID, 33), nil)
+	storage.On("Increment", mock.Anything, newCounter.ID, *newCounter.Delta).Return(newCounter, nil)
 	storage.On("Save", mock.Anything, mock.Anything).Return(nil)
 
 	server := setupServer(storage)
@@ -441,6 +464,7 @@ func TestMetricHandler_Update(t *testing.T) {
 	storage.On("Save", mock.Anything, mock.Anything).Return(nil)
 	storage.On("Get", mock.Anything, mock.Anything, mock.MatchedBy(metricMatcher("testGauge"))).Return(metric.NewGaugeMetric("testGauge", 20), nil)
 	storage.On("Get", mock.Anything, mock.Anything, mock.MatchedBy(metricMatcher("testCounter"))).Return(metric.NewCounterMetric("testCounter", 20), nil)
+	storage.On("Increment", mock.Anything, "testCounter", int64(10)).Return(metric.NewCounterMetric("testCounter", 30), nil)
 
 	server := setupServer(storage)
 	defer server.Close()
@@ -587,7 +611,7 @@ func TestMetricHandler_AllValues(t *testing.T) {
 
 	for _, m := range metrics {
 
-		if strings.Contains(html, fmt.Sprintf("<li>%s: %v</li>", m.ID, m.ValueToString())) {
+		if strings.Contains(html, fmt.Sprintf("<li>%s: %v</li>", m.ID, m.FormatValue())) {
 			match++
 		}
 	}
@@ -595,6 +619,87 @@ func TestMetricHandler_AllValues(t *testing.T) {
 	assert.Equal(t, match, len(metrics))
 }
 
+func TestMetricHandler_AllValuesNegotiation(t *testing.T) {
+	storage := &metricStorageMock{}
+
+	storage.On("All", mock.Anything).Return(
+		metric.NewCounterMetric("requests", 10),
+		metric.NewGaugeMetric("<script>alert(1)</script>", 1.5),
+		metric.NewGaugeMetric("requests", 10),
+		metric.NewGaugeMetric("idle", 0),
+		metric.NewGaugeMetric("cpu.total", 0.25),
+		metric.NewGaugeMetric("cpu-total", 0.75),
+		nil,
+	)
+
+	server := setupServer(storage)
+	defer server.Close()
+
+	get := func(t *testing.T, accept string) (*http.Response, string) {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+		require.NoError(t, err)
+
+		request.Header.Set("Accept", accept)
+
+		result, err := server.Client().Do(request)
+		require.NoError(t, err)
+
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.NoError(t, result.Body.Close())
+
+		return result, string(body)
+	}
+
+	t.Run("html escapes ids", func(t *testing.T) {
+		result, body := get(t, "text/html")
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/html", result.Header.Get("Content-Type"))
+		assert.NotContains(t, body, "<script>")
+		assert.Contains(t, body, "<li>&lt;script&gt;alert(1)&lt;/script&gt;: 1.5</li>")
+		assert.Contains(t, body, "<li>requests: 10</li>")
+		assert.Contains(t, body, "<li>idle: 0</li>")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		result, body := get(t, "application/json")
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "application/json", result.Header.Get("Content-Type"))
+
+		var metrics []metric.Metric
+		require.NoError(t, json.Unmarshal([]byte(body), &metrics))
+		assert.Len(t, metrics, 6)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		result, body := get(t, "text/csv")
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/csv", result.Header.Get("Content-Type"))
+		assert.Equal(t, "type,id,value\ncounter,requests,10\ngauge,<script>alert(1)</script>,1.5\ngauge,requests,10\ngauge,idle,0\ngauge,cpu.total,0.25\ngauge,cpu-total,0.75\n", body)
+	})
+
+	t.Run("prometheus", func(t *testing.T) {
+		result, body := get(t, "application/openmetrics-text;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1")
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", result.Header.Get("Content-Type"))
+		assert.Equal(t, "# TYPE requests_counter counter\nrequests_counter 10\n"+
+			"# TYPE _script_alert_1___script_ gauge\n_script_alert_1___script_ 1.5\n"+
+			"# TYPE requests_gauge gauge\nrequests_gauge 10\n"+
+			"# TYPE idle gauge\nidle 0\n"+
+			"# TYPE cpu_total_gauge gauge\ncpu_total_gauge 0.25\n", body)
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		result, _ := get(t, "image/png")
+
+		assert.Equal(t, http.StatusNotAcceptable, result.StatusCode)
+	})
+}
+
 func TestGzipCompress(t *testing.T) {
 	storage := &metricStorageMock{}
 
@@ -670,3 +775,138 @@ func TestGzipCompress(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+func TestMetricHandler_Updates(t *testing.T) {
+	storage := &metricStorageMock{}
+
+	storage.On("Increment", mock.Anything, mock.Anything, mock.Anything).Return(metric.NewCounterMetric("counter", 1), nil)
+	storage.On("Save", mock.Anything, mock.Anything).Return(nil)
+
+	server := setupServer(storage)
+	defer server.Close()
+
+	batch := `[
+		{"id": "counter", "type": "counter", "delta": 1},
+		{"id": "bad_type", "type": "histogram", "value": 1},
+		{"id": " ", "type": "gauge", "value": 1},
+		{"id": "no_value", "type": "gauge"},
+		{"id": "gauge", "type": "gauge", "value": 1.5}
+	]`
+
+	t.Run("all or nothing", func(t *testing.T) {
+		status, _ := doRequest(t, server, "/updates/", strings.NewReader(batch))
+
+		require.Equal(t, http.StatusBadRequest, status)
+		storage.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		status, res := doRequest(t, server, "/updates/?partial=true", strings.NewReader(batch))
+
+		require.Equal(t, http.StatusMultiStatus, status)
+
+		var result batchResult
+
+		require.NoError(t, json.NewDecoder(res).Decode(&result))
+
+		assert.Equal(t, 2, result.Accepted)
+		assert.Equal(t, 3, result.Rejected)
+		assert.Equal(t, []itemResult{
+			{Index: 0, ID: "counter", Status: itemStatusAccepted},
+			{Index: 1, ID: "bad_type", Status: itemStatusRejected, Code: "invalid_type", Error: metric.ErrIncorrectType.Error()},
+			{Index: 2, ID: " ", Status: itemStatusRejected, Code: "empty_id", Error: metric.ErrEmptyID.Error()},
+			{Index: 3, ID: "no_value", Status: itemStatusRejected, Code: "invalid_value", Error: metric.ErrIncorrectValue.Error()},
+			{Index: 4, ID: "gauge", Status: itemStatusAccepted},
+		}, result.Results)
+
+		storage.AssertCalled(t, "Increment", mock.Anything, "counter", int64(1))
+		storage.AssertCalled(t, "Save", mock.Anything, metric.NewGaugeMetric("gauge", 1.5))
+	})
+
+	t.Run("partial all accepted", func(t *testing.T) {
+		status, res := doRequest(t, server, "/updates/?partial=true", strings.NewReader(`[{"id": "gauge", "type": "gauge", "value": 2}]`))
+
+		require.Equal(t, http.StatusOK, status)
+
+		var result batchResult
+
+		require.NoError(t, json.NewDecoder(res).Decode(&result))
+
+		assert.Equal(t, 1, result.Accepted)
+		assert.Equal(t, 0, result.Rejected)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		router := chi.NewMux()
+
+		NewMetricHandler(storage, service.NewMetricUpdateService(storage, transactions.DiscardManager{})).
+			WithMaxBatch(4).
+			Register(router)
+
+		limited := httptest.NewServer(router)
+		defer limited.Close()
+
+		large := `[
+			{"id": "a", "type": "gauge", "value": 1},
+			{"id": "b", "type": "gauge", "value": 1},
+			{"id": "c", "type": "gauge", "value": 1},
+			{"id": "d", "type": "gauge", "value": 1},
+			{"id": "e", "type": "gauge", "value": 1}
+		]`
+
+		for _, url := range []string{"/updates/", "/updates/?partial=true"} {
+			status, res := doRequest(t, limited, url, strings.NewReader(large))
+
+			require.Equal(t, http.StatusRequestEntityTooLarge, status, url)
+
+			body, err := io.ReadAll(res)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), `"batch_too_large"`)
+		}
+	})
+}
+
+func TestMetricHandler_ErrorBody(t *testing.T) {
+	storage := &metricStorageMock{}
+
+	storage.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(metric.Metric{}, metric.ErrMetricNotFound)
+
+	server := setupServer(storage)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+		code   response.Code
+	}{
+		{"empty body", "/update/", "", http.StatusBadRequest, response.CodeEmptyBody},
+		{"malformed json", "/updates/", `[{"id": "a"`, http.StatusBadRequest, response.CodeInvalidJSON},
+		{"wrong json shape", "/update/", `[]`, http.StatusBadRequest, response.CodeInvalidJSON},
+		{"incorrect type", "/update/", `{"id": "a", "type": "b"}`, http.StatusBadRequest, response.CodeInvalidType},
+		{"missing value", "/update/", `{"id": "a", "type": "gauge"}`, http.StatusBadRequest, response.CodeInvalidValue},
+		{"empty id", "/value/", `{"id": "", "type": "gauge"}`, http.StatusBadRequest, response.CodeEmptyID},
+		{"not found", "/value/", `{"id": "a", "type": "gauge"}`, http.StatusNotFound, response.CodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := doRequest(t, server, tt.url, strings.NewReader(tt.body))
+
+			require.Equal(t, tt.status, status)
+
+			var body struct {
+				Status int
+				Code   response.Code
+				Error  string
+			}
+
+			require.NoError(t, json.NewDecoder(res).Decode(&body))
+
+			assert.Equal(t, tt.status, body.Status)
+			assert.Equal(t, tt.code, body.Code)
+			assert.NotEmpty(t, body.Error)
+		})
+	}
+}
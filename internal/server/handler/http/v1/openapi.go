@@ -0,0 +1,34 @@
+package v1
+
+import (
+	_ "embed"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+)
+
+// openAPISpec describes every route of this package. openapi_test.go
+// checks the real handlers against it so the two cannot drift apart.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+type OpenAPIHandler struct{}
+
+func NewOpenAPIHandler() *OpenAPIHandler {
+	return &OpenAPIHandler{}
+}
+
+func (h *OpenAPIHandler) Register(router chi.Router) {
+	router.Get(`/openapi.json`, h.Spec)
+}
+
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(openAPISpec); err != nil {
+		slog.Error("Failed to write response body", "error", err)
+	}
+}
@@ -0,0 +1,222 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/broker"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/v2"
+	"github.com/baisalov/metricollector/internal/server/service"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/baisalov/metricollector/internal/transactions"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/javascript", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("text/css", openapi3filter.FileBodyDecoder)
+}
+
+func jsonBody(body string) *string {
+	return &body
+}
+
+func loadOpenAPI(t *testing.T) *openapi3.T {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	require.NoError(t, err)
+
+	require.NoError(t, doc.Validate(context.Background()))
+
+	return doc
+}
+
+func setupOpenAPIServer(storage *metricStorageMock) (*chi.Mux, *httptest.Server) {
+	router := chi.NewMux()
+
+	tokens, err := memory.NewTokenStore("")
+	if err != nil {
+		panic(err)
+	}
+
+	router.Use(middleware.GzipCompress, middleware.GzipDecompress)
+
+	updater := service.NewMetricUpdateService(storage, transactions.DiscardManager{})
+
+	NewMetricHandler(storage, updater).Register(router)
+	v2.NewMetricHandler(storage, updater).Register(router)
+	v2.NewStreamHandler(broker.NewBroker()).Register(router)
+	v2.NewExportHandler(storage).Register(router)
+	NewHealthCheckHandler(&mockChecker{checkFunc: func(ctx context.Context) error { return nil }}).Register(router)
+	NewAdminHandler(backuperMock{data: "snapshot"}).Register(router)
+	NewTokenHandler(tokens).Register(router)
+	NewDashboardHandler(storage).Register(router)
+	NewOpenAPIHandler().Register(router)
+
+	return router, httptest.NewServer(router)
+}
+
+func TestOpenAPI_CoversRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	router, server := setupOpenAPIServer(&metricStorageMock{})
+	defer server.Close()
+
+	slashes := regexp.MustCompile(`/+`)
+	wildcard := regexp.MustCompile(`/\*$`)
+
+	err := chi.Walk(router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = slashes.ReplaceAllString(route, "/")
+		route = wildcard.ReplaceAllString(route, "/{path}")
+
+		item := doc.Paths.Find(route)
+		if item == nil && route != "/" {
+			item = doc.Paths.Find(strings.TrimSuffix(route, "/"))
+		}
+
+		if assert.NotNil(t, item, "route %s is not described", route) {
+			assert.NotNil(t, item.GetOperation(method), "operation %s %s is not described", method, route)
+		}
+
+		return nil
+	})
+
+	require.NoError(t, err)
+}
+
+func TestOpenAPI_Handlers(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	storage := &metricStorageMock{}
+
+	counter := metric.NewCounterMetric("counter", 10)
+	gauge := metric.NewGaugeMetric("gauge", 1.5)
+
+	storage.On("Get", mock.Anything, metric.Counter, counter.ID).Return(counter, nil)
+	storage.On("Get", mock.Anything, metric.Gauge, gauge.ID).Return(gauge, nil)
+	storage.On("Get", mock.Anything, mock.Anything, mock.Anything).Return(metric.Metric{}, metric.ErrMetricNotFound)
+	storage.On("Increment", mock.Anything, mock.Anything, mock.Anything).Return(counter, nil)
+	storage.On("Save", mock.Anything, mock.Anything).Return(nil)
+	storage.On("All", mock.Anything).Return(counter, gauge, nil)
+
+	_, server := setupOpenAPIServer(storage)
+	defer server.Close()
+
+	doc.Servers = openapi3.Servers{{URL: server.URL}}
+
+	router, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		// body is sent as application/json unless it is nil.
+		body *string
+		// invalid requests are sent anyway to check the error responses.
+		invalid bool
+		status  int
+	}{
+		{"update", http.MethodPost, "/update/counter/counter/1", nil, false, http.StatusOK},
+		{"update bad value", http.MethodPost, "/update/gauge/gauge/abc", nil, false, http.StatusBadRequest},
+		{"value", http.MethodGet, "/value/gauge/gauge", nil, false, http.StatusOK},
+		{"value not found", http.MethodGet, "/value/gauge/unknown", nil, false, http.StatusNotFound},
+		{"value bad type", http.MethodGet, "/value/histogram/gauge", nil, false, http.StatusBadRequest},
+		{"all values html", http.MethodGet, "/", nil, false, http.StatusOK},
+		{"all values", http.MethodPost, "/", jsonBody(``), false, http.StatusOK},
+		{"update json", http.MethodPost, "/update/", jsonBody(`{"id": "counter", "type": "counter", "delta": 1}`), false, http.StatusOK},
+		{"update json bad type", http.MethodPost, "/update/", jsonBody(`{"id": "x", "type": "histogram", "value": 1}`), true, http.StatusBadRequest},
+		{"updates", http.MethodPost, "/updates/", jsonBody(`[{"id": "gauge", "type": "gauge", "value": 2}]`), false, http.StatusOK},
+		{"updates empty body", http.MethodPost, "/updates/", jsonBody(``), true, http.StatusBadRequest},
+		{"updates partial", http.MethodPost, "/updates/?partial=true", jsonBody(`[{"id": "gauge", "type": "gauge", "value": 2}, {"id": "x", "type": "gauge"}]`), false, http.StatusMultiStatus},
+		{"value json", http.MethodPost, "/value/", jsonBody(`{"id": "counter", "type": "counter"}`), false, http.StatusOK},
+		{"value json not found", http.MethodPost, "/value/", jsonBody(`{"id": "unknown", "type": "counter"}`), false, http.StatusNotFound},
+		{"ping", http.MethodGet, "/ping", nil, false, http.StatusOK},
+		{"backup", http.MethodGet, "/admin/backup", nil, false, http.StatusOK},
+		{"openapi", http.MethodGet, "/openapi.json", nil, false, http.StatusOK},
+		{"dashboard", http.MethodGet, "/dashboard/", nil, false, http.StatusOK},
+		{"dashboard login", http.MethodGet, "/dashboard/login", nil, false, http.StatusOK},
+		{"dashboard script", http.MethodGet, "/dashboard/static/app.js", nil, false, http.StatusOK},
+		{"dashboard stylesheet", http.MethodGet, "/dashboard/static/style.css", nil, false, http.StatusOK},
+		{"dashboard missing asset", http.MethodGet, "/dashboard/static/unknown.js", nil, false, http.StatusNotFound},
+		{"v2 list", http.MethodGet, "/api/v2/metrics", nil, false, http.StatusOK},
+		{"v2 get", http.MethodGet, "/api/v2/metrics/counter/counter", nil, false, http.StatusOK},
+		{"v2 get not found", http.MethodGet, "/api/v2/metrics/gauge/unknown", nil, false, http.StatusNotFound},
+		{"v2 put", http.MethodPut, "/api/v2/metrics/gauge/gauge", jsonBody(`{"value": 3}`), false, http.StatusOK},
+		{"v2 put without value", http.MethodPut, "/api/v2/metrics/gauge/gauge", jsonBody(`{}`), false, http.StatusBadRequest},
+		{"v2 patch", http.MethodPatch, "/api/v2/metrics/counter/counter", jsonBody(`{"delta": 3}`), false, http.StatusOK},
+		{"v2 export csv", http.MethodGet, "/api/v2/metrics/export.csv", nil, false, http.StatusOK},
+		{"v2 export ndjson", http.MethodGet, "/api/v2/metrics/export.ndjson", nil, false, http.StatusOK},
+		{"tokens", http.MethodGet, "/admin/tokens", nil, false, http.StatusOK},
+		{"create token", http.MethodPost, "/admin/tokens", jsonBody(`{"name": "agent", "scopes": ["write"]}`), false, http.StatusCreated},
+		{"create token bad scope", http.MethodPost, "/admin/tokens", jsonBody(`{"name": "agent", "scopes": ["root"]}`), true, http.StatusBadRequest},
+		{"revoke unknown token", http.MethodDelete, "/admin/tokens/unknown", nil, false, http.StatusNotFound},
+		{"v2 batch", http.MethodPost, "/api/v2/metrics/batch", jsonBody(`[{"id": "gauge", "type": "gauge", "value": 2}]`), false, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != nil {
+				body = strings.NewReader(*tt.body)
+			}
+
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, body)
+			require.NoError(t, err)
+
+			if body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			route, pathParams, err := router.FindRoute(req)
+			require.NoError(t, err)
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    &openapi3filter.Options{MultiError: true, AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			}
+
+			if !tt.invalid {
+				require.NoError(t, openapi3filter.ValidateRequest(context.Background(), input))
+
+				if body != nil {
+					req.Body = io.NopCloser(strings.NewReader(*tt.body))
+				}
+			}
+
+			res, err := server.Client().Do(req)
+			require.NoError(t, err)
+
+			resBody, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+
+			require.Equal(t, tt.status, res.StatusCode, string(resBody))
+
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 res.StatusCode,
+				Header:                 res.Header,
+				Body:                   io.NopCloser(bytes.NewReader(resBody)),
+				Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package v1
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"html/template"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	contentTypeHTML       = "text/html"
+	contentTypeJSON       = "application/json"
+	contentTypeCSV        = "text/csv"
+	contentTypePrometheus = "text/plain"
+)
+
+// prometheusVersion is the version of the Prometheus text exposition
+// format written by renderPrometheus.
+const prometheusVersion = "0.0.4"
+
+//go:embed templates
+var templatesFS embed.FS
+
+var valuesTemplate = template.Must(template.ParseFS(templatesFS, "templates/values.html"))
+
+func renderHTML(w io.Writer, metrics []metric.Metric) error {
+	return valuesTemplate.ExecuteTemplate(w, "values.html", metrics)
+}
+
+func renderCSV(w io.Writer, metrics []metric.Metric) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"type", "id", "value"}); err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		if err := cw.Write([]string{string(m.MType), m.ID, m.FormatValue()}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+func renderPrometheus(w io.Writer, metrics []metric.Metric) error {
+	names := make(map[string]int, len(metrics))
+	for _, m := range metrics {
+		names[prometheusName(m.ID)]++
+	}
+
+	written := make(map[string]bool, len(metrics))
+
+	for _, m := range metrics {
+		name := prometheusName(m.ID)
+
+		// A counter and a gauge may share an ID, but one metric name
+		// can only have one type, so shared names get the type appended.
+		if names[name] > 1 {
+			name += "_" + string(m.MType)
+		}
+
+		// IDs differing only in the characters replaced by
+		// prometheusName still clash, only the first one is written.
+		if written[name] {
+			slog.Warn("skipping metric with a clashing prometheus name", "id", m.ID, "name", name)
+			continue
+		}
+
+		written[name] = true
+
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n%s %s\n", name, m.MType, name, m.FormatValue()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prometheusName replaces the characters Prometheus does not allow in
+// metric names with underscores.
+func prometheusName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+
+		return '_'
+	}, id)
+
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
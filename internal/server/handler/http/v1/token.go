@@ -0,0 +1,98 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+)
+
+type tokenStore interface {
+	Create(ctx context.Context, t auth.Token) error
+	List(ctx context.Context) ([]auth.Token, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+type TokenHandler struct {
+	store tokenStore
+}
+
+func NewTokenHandler(store tokenStore) *TokenHandler {
+	return &TokenHandler{store: store}
+}
+
+func (h *TokenHandler) Register(router chi.Router) {
+	router.With(middleware.Authorize(auth.ScopeAdmin)).Route(`/admin/tokens`, func(r chi.Router) {
+		r.Get(`/`, h.List)
+		r.With(middleware.AcceptedContentTypeJSON).Post(`/`, h.Create)
+		r.Delete(`/{id}`, h.Revoke)
+	})
+}
+
+type createTokenRequest struct {
+	Name   string       `json:"name"`
+	Scopes []auth.Scope `json:"scopes"`
+}
+
+type createTokenResponse struct {
+	auth.Token
+	// Secret is shown once; only its hash is kept.
+	Secret string `json:"token"`
+}
+
+// Create issues a token and returns its secret.
+func (h *TokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	token, secret, err := auth.Issue(req.Name, req.Scopes)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	if err = h.store.Create(r.Context(), token); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	slog.Info("api token created", "id", token.ID, "name", token.Name, "scopes", token.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(w).Encode(createTokenResponse{Token: token, Secret: secret}); err != nil {
+		slog.Error("failed to write response body", "error", err)
+	}
+}
+
+func (h *TokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.store.List(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, tokens)
+}
+
+func (h *TokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.store.Revoke(r.Context(), id); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	slog.Info("api token revoked", "id", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
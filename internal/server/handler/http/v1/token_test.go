@@ -0,0 +1,98 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenHandler(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := memory.NewTokenStore("")
+	require.NoError(t, err)
+
+	admin, adminSecret, err := auth.Issue("root", []auth.Scope{auth.ScopeAdmin})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, admin))
+
+	router := chi.NewMux()
+	router.Use(middleware.Authenticate(store))
+
+	NewTokenHandler(store).Register(router)
+
+	do := func(method, path, secret, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	var created struct {
+		ID     string       `json:"id"`
+		Scopes []auth.Scope `json:"scopes"`
+		Token  string       `json:"token"`
+	}
+
+	t.Run("create", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/tokens", adminSecret, `{"name": "agent", "scopes": ["write"]}`)
+
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+		assert.Equal(t, []auth.Scope{auth.ScopeWrite}, created.Scopes)
+		assert.NotContains(t, rec.Body.String(), auth.Hash(created.Token))
+
+		token, err := store.Find(ctx, auth.Hash(created.Token))
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, token.ID)
+	})
+
+	t.Run("create with invalid scope", func(t *testing.T) {
+		rec := do(http.MethodPost, "/admin/tokens", adminSecret, `{"name": "agent", "scopes": ["root"]}`)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("requires admin scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/admin/tokens", "", "").Code)
+		assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/admin/tokens", created.Token, "").Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := do(http.MethodGet, "/admin/tokens", adminSecret, "")
+
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var tokens []auth.Token
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+		assert.Len(t, tokens, 2)
+		assert.NotContains(t, rec.Body.String(), admin.Hash)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/admin/tokens/"+created.ID, adminSecret, "").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/admin/tokens/"+created.ID, adminSecret, "").Code)
+
+		_, err := store.Find(ctx, auth.Hash(created.Token))
+		assert.ErrorIs(t, err, auth.ErrTokenNotFound)
+	})
+}
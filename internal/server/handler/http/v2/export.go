@@ -0,0 +1,113 @@
+package v2
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+)
+
+type metricIterator interface {
+	Each(ctx context.Context, fn func(metric.Metric) error) error
+}
+
+// ExportHandler streams every metric straight from the storage, so the
+// export size is not limited by the server memory.
+type ExportHandler struct {
+	iterator metricIterator
+}
+
+func NewExportHandler(iterator metricIterator) *ExportHandler {
+	return &ExportHandler{iterator: iterator}
+}
+
+func (h *ExportHandler) Register(router chi.Router) {
+	read := middleware.Authorize(auth.ScopeRead)
+
+	router.With(read).Get(`/api/v2/metrics/export.csv`, h.CSV)
+	router.With(read).Get(`/api/v2/metrics/export.ndjson`, h.NDJSON)
+}
+
+// CSV exports metrics as type,id,value rows after a header row.
+func (h *ExportHandler) CSV(w http.ResponseWriter, r *http.Request) {
+	cw := csv.NewWriter(w)
+
+	h.export(w, r, "text/csv", "metrics.csv",
+		func() error {
+			return cw.Write([]string{"type", "id", "value"})
+		},
+		func(m metric.Metric) error {
+			return cw.Write([]string{string(m.MType), m.ID, m.FormatValue()})
+		},
+		func() error {
+			cw.Flush()
+			return cw.Error()
+		},
+	)
+}
+
+// NDJSON exports metrics as one JSON object per line.
+func (h *ExportHandler) NDJSON(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+
+	h.export(w, r, "application/x-ndjson", "metrics.ndjson",
+		func() error { return nil },
+		func(m metric.Metric) error { return encoder.Encode(m) },
+		func() error { return nil },
+	)
+}
+
+// export writes the headers only once the first metric is read, so a
+// storage failure before that still gets a proper error response.
+func (h *ExportHandler) export(w http.ResponseWriter, r *http.Request, contentType, filename string,
+	begin func() error, write func(metric.Metric) error, end func() error) {
+
+	started := false
+
+	start := func() error {
+		if started {
+			return nil
+		}
+
+		started = true
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename=%q`, filename))
+
+		w.WriteHeader(http.StatusOK)
+
+		return begin()
+	}
+
+	err := h.iterator.Each(r.Context(), func(m metric.Metric) error {
+		if err := start(); err != nil {
+			return err
+		}
+
+		return write(m)
+	})
+
+	if err != nil && !started {
+		response.Error(w, err)
+		return
+	}
+
+	if err == nil {
+		err = start()
+	}
+
+	if err == nil {
+		err = end()
+	}
+
+	if err != nil {
+		slog.Error("failed to export metrics", "error", err)
+	}
+}
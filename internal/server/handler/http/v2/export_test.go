@@ -0,0 +1,90 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type iteratorMock struct {
+	metrics []metric.Metric
+	err     error
+}
+
+func (i iteratorMock) Each(_ context.Context, fn func(metric.Metric) error) error {
+	for _, m := range i.metrics {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return i.err
+}
+
+func TestExportHandler(t *testing.T) {
+	metrics := []metric.Metric{
+		metric.NewCounterMetric("requests", 10),
+		metric.NewGaugeMetric("cpu, total", 0.5),
+		metric.NewGaugeMetric("load", 10),
+		metric.NewGaugeMetric("idle", 0),
+	}
+
+	serve := func(iterator iteratorMock, path string) *httptest.ResponseRecorder {
+		router := chi.NewMux()
+
+		NewExportHandler(iterator).Register(router)
+
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return recorder
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		recorder := serve(iteratorMock{metrics: metrics}, "/api/v2/metrics/export.csv")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "text/csv", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="metrics.csv"`, recorder.Header().Get("Content-Disposition"))
+		assert.Equal(t, "type,id,value\ncounter,requests,10\ngauge,\"cpu, total\",0.5\ngauge,load,10\ngauge,idle,0\n", recorder.Body.String())
+	})
+
+	t.Run("csv empty", func(t *testing.T) {
+		recorder := serve(iteratorMock{}, "/api/v2/metrics/export.csv")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "type,id,value\n", recorder.Body.String())
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		recorder := serve(iteratorMock{metrics: metrics}, "/api/v2/metrics/export.ndjson")
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, `{"id":"requests","type":"counter","delta":10}
+{"id":"cpu, total","type":"gauge","value":0.5}
+{"id":"load","type":"gauge","value":10}
+{"id":"idle","type":"gauge","value":0}
+`, recorder.Body.String())
+	})
+
+	t.Run("storage failure", func(t *testing.T) {
+		recorder := serve(iteratorMock{err: metric.ErrStorageUnavailable}, "/api/v2/metrics/export.ndjson")
+
+		assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	})
+
+	t.Run("failure after start", func(t *testing.T) {
+		recorder := serve(iteratorMock{metrics: metrics, err: errors.New("broken")}, "/api/v2/metrics/export.ndjson")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	})
+}
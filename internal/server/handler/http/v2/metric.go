@@ -0,0 +1,203 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+)
+
+type MetricHandler struct {
+	provider metricProvider
+	updater  metricUpdater
+	maxBatch int
+}
+
+type metricUpdater interface {
+	Set(ctx context.Context, m metric.Metric) (metric.Metric, error)
+	Update(ctx context.Context, m metric.Metric) (metric.Metric, error)
+	Updates(ctx context.Context, metrics ...metric.Metric) error
+}
+
+type metricProvider interface {
+	Get(ctx context.Context, t metric.Type, id string) (metric.Metric, error)
+	All(ctx context.Context) ([]metric.Metric, error)
+}
+
+func NewMetricHandler(provider metricProvider, updater metricUpdater) *MetricHandler {
+	return &MetricHandler{
+		provider: provider,
+		updater:  updater,
+	}
+}
+
+// WithMaxBatch makes the handler reject batches of more than n metrics
+// with 413. Batches are not limited when n is zero.
+func (h *MetricHandler) WithMaxBatch(n int) *MetricHandler {
+	h.maxBatch = n
+	return h
+}
+
+func (h *MetricHandler) batchTooLarge(n int) bool {
+	return h.maxBatch > 0 && n > h.maxBatch
+}
+
+func (h *MetricHandler) Register(router chi.Router) {
+	read := middleware.Authorize(auth.ScopeRead)
+	write := middleware.Authorize(auth.ScopeWrite)
+
+	router.Route(`/api/v2/metrics`, func(r chi.Router) {
+		r.With(read).Get(`/`, h.List)
+		r.With(read).Get(`/{type}/{id}`, h.Get)
+
+		r.With(write, middleware.AcceptedContentTypeJSON).Put(`/{type}/{id}`, h.Put)
+		r.With(write, middleware.AcceptedContentTypeJSON).Patch(`/{type}/{id}`, h.Patch)
+		r.With(write, middleware.AcceptedContentTypeJSON).Post(`/batch`, h.Batch)
+	})
+}
+
+// List returns all metrics.
+func (h *MetricHandler) List(w http.ResponseWriter, r *http.Request) {
+	res, err := h.provider.All(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	if res == nil {
+		res = []metric.Metric{}
+	}
+
+	response.Success(w, res)
+}
+
+// Get returns one metric.
+func (h *MetricHandler) Get(w http.ResponseWriter, r *http.Request) {
+	t, id, err := pathKey(r)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	res, err := h.provider.Get(r.Context(), t, id)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, res)
+}
+
+// Put replaces the metric: gauges get the new value and counters the new
+// total instead of being incremented.
+func (h *MetricHandler) Put(w http.ResponseWriter, r *http.Request) {
+	m, err := decodeMetric(r)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	res, err := h.updater.Set(r.Context(), m)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, res)
+}
+
+// Patch increments a counter by the delta from the body.
+func (h *MetricHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	m, err := decodeMetric(r)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	if m.MType != metric.Counter {
+		response.Error(w, fmt.Errorf("%w: only counters can be incremented", metric.ErrIncorrectType))
+		return
+	}
+
+	res, err := h.updater.Update(r.Context(), m)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, res)
+}
+
+// Batch applies a list of metrics all or nothing, with the same
+// semantics as PATCH for counters and PUT for gauges.
+func (h *MetricHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	var metrics []metric.Metric
+
+	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	if h.batchTooLarge(len(metrics)) {
+		response.Error(w, response.ErrBatchTooLarge)
+		return
+	}
+
+	for _, m := range metrics {
+		if err := m.Validate(); err != nil {
+			response.Error(w, err)
+			return
+		}
+	}
+
+	slog.Debug("Batch", "request", metrics)
+
+	if err := h.updater.Updates(r.Context(), metrics...); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func pathKey(r *http.Request) (metric.Type, string, error) {
+	t := metric.ParseType(chi.URLParam(r, "type"))
+	if !t.IsValid() {
+		return t, "", metric.ErrIncorrectType
+	}
+
+	return t, chi.URLParam(r, "id"), nil
+}
+
+// decodeMetric reads the value from the body and the key from the path.
+func decodeMetric(r *http.Request) (metric.Metric, error) {
+	t, id, err := pathKey(r)
+	if err != nil {
+		return metric.Metric{}, err
+	}
+
+	var body struct {
+		Delta *int64   `json:"delta"`
+		Value *float64 `json:"value"`
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return metric.Metric{}, err
+	}
+
+	m := metric.Metric{ID: id, MType: t, Delta: body.Delta, Value: body.Value}
+
+	if t == metric.Counter {
+		m.Value = nil
+	} else {
+		m.Delta = nil
+	}
+
+	return m, m.Validate()
+}
@@ -0,0 +1,148 @@
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/baisalov/metricollector/internal/server/service"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupServer(t *testing.T) (*memory.MetricStorage, *httptest.Server) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "storage.txt"))
+	require.NoError(t, err)
+
+	storage, err := memory.NewMetricStorage(file, 0, false)
+	require.NoError(t, err)
+
+	router := chi.NewMux()
+
+	NewMetricHandler(storage, service.NewMetricUpdateService(storage, memory.NewTransactionManager(storage))).Register(router)
+
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() {
+		server.Close()
+		require.NoError(t, storage.Close())
+		require.NoError(t, file.Close())
+	})
+
+	return storage, server
+}
+
+func doRequest(t *testing.T, server *httptest.Server, method, url, body string) (int, []byte) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+
+	request, err := http.NewRequest(method, server.URL+url, r)
+	require.NoError(t, err)
+
+	if r != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	result, err := server.Client().Do(request)
+	require.NoError(t, err)
+
+	res, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	require.NoError(t, result.Body.Close())
+
+	return result.StatusCode, res
+}
+
+func TestMetricHandler(t *testing.T) {
+	storage, server := setupServer(t)
+	ctx := context.Background()
+
+	require.NoError(t, storage.Save(ctx, metric.NewCounterMetric("requests", 10)))
+	require.NoError(t, storage.Save(ctx, metric.NewGaugeMetric("load", 0.5)))
+
+	t.Run("list", func(t *testing.T) {
+		status, body := doRequest(t, server, http.MethodGet, "/api/v2/metrics", "")
+		require.Equal(t, http.StatusOK, status)
+
+		var metrics []metric.Metric
+
+		require.NoError(t, json.Unmarshal(body, &metrics))
+		assert.Len(t, metrics, 2)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		status, body := doRequest(t, server, http.MethodGet, "/api/v2/metrics/gauge/load", "")
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"id": "load", "type": "gauge", "value": 0.5}`, string(body))
+	})
+
+	t.Run("get not found", func(t *testing.T) {
+		status, body := doRequest(t, server, http.MethodGet, "/api/v2/metrics/gauge/unknown", "")
+		require.Equal(t, http.StatusNotFound, status)
+		assert.Contains(t, string(body), string(response.CodeNotFound))
+	})
+
+	t.Run("get incorrect type", func(t *testing.T) {
+		status, _ := doRequest(t, server, http.MethodGet, "/api/v2/metrics/histogram/load", "")
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("put replaces counter", func(t *testing.T) {
+		status, body := doRequest(t, server, http.MethodPut, "/api/v2/metrics/counter/requests", `{"delta": 3}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"id": "requests", "type": "counter", "delta": 3}`, string(body))
+	})
+
+	t.Run("put without value", func(t *testing.T) {
+		status, body := doRequest(t, server, http.MethodPut, "/api/v2/metrics/gauge/load", `{"delta": 3}`)
+		require.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, string(body), string(response.CodeInvalidValue))
+	})
+
+	t.Run("patch increments counter", func(t *testing.T) {
+		status, body := doRequest(t, server, http.MethodPatch, "/api/v2/metrics/counter/requests", `{"delta": 4}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.JSONEq(t, `{"id": "requests", "type": "counter", "delta": 7}`, string(body))
+	})
+
+	t.Run("patch gauge", func(t *testing.T) {
+		status, _ := doRequest(t, server, http.MethodPatch, "/api/v2/metrics/gauge/load", `{"value": 1}`)
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		status, _ := doRequest(t, server, http.MethodPost, "/api/v2/metrics/batch",
+			`[{"id": "requests", "type": "counter", "delta": 1}, {"id": "load", "type": "gauge", "value": 0.7}]`)
+		require.Equal(t, http.StatusNoContent, status)
+
+		m, err := storage.Get(ctx, metric.Counter, "requests")
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), *m.Delta)
+
+		m, err = storage.Get(ctx, metric.Gauge, "load")
+		require.NoError(t, err)
+		assert.Equal(t, 0.7, *m.Value)
+	})
+
+	t.Run("batch is all or nothing", func(t *testing.T) {
+		status, _ := doRequest(t, server, http.MethodPost, "/api/v2/metrics/batch",
+			`[{"id": "requests", "type": "counter", "delta": 1}, {"id": "load", "type": "gauge"}]`)
+		require.Equal(t, http.StatusBadRequest, status)
+
+		m, err := storage.Get(ctx, metric.Counter, "requests")
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), *m.Delta)
+	})
+}
@@ -0,0 +1,125 @@
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/broker"
+	"github.com/baisalov/metricollector/internal/server/handler/http/middleware"
+	"github.com/baisalov/metricollector/internal/server/handler/http/response"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// heartbeatInterval keeps idle streams alive through proxies that close
+// silent connections.
+const heartbeatInterval = 15 * time.Second
+
+type subscriber interface {
+	Subscribe(filter broker.Filter) *broker.Subscription
+}
+
+type StreamHandler struct {
+	subscriber subscriber
+}
+
+func NewStreamHandler(subscriber subscriber) *StreamHandler {
+	return &StreamHandler{subscriber: subscriber}
+}
+
+func (h *StreamHandler) Register(router chi.Router) {
+	router.With(middleware.Authorize(auth.ScopeRead)).Get(`/api/v2/metrics/stream`, h.Stream)
+}
+
+// Stream sends committed metric updates as Server-Sent Events until the
+// client goes away. The type query parameter may be repeated or comma
+// separated, id is a glob pattern.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	filter := streamFilter(r)
+
+	if err := filter.Validate(); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	// the stream outlives the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to reset write deadline", "error", err)
+	}
+
+	sub := h.subscriber.Subscribe(filter)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		slog.Error("failed to flush stream", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-r.Context().Done():
+			return
+		case m, ok := <-sub.C():
+			if !ok {
+				return
+			}
+
+			err = writeEvent(w, m)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+
+		if err != nil {
+			slog.Debug("stream closed", "error", err)
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, m metric.Metric) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data)
+
+	return err
+}
+
+func streamFilter(r *http.Request) broker.Filter {
+	query := r.URL.Query()
+
+	filter := broker.Filter{ID: query.Get("id")}
+
+	for _, v := range query["type"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, metric.ParseType(t))
+			}
+		}
+	}
+
+	return filter
+}
@@ -0,0 +1,97 @@
+package v2
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/broker"
+	"github.com/baisalov/metricollector/internal/server/service"
+	"github.com/baisalov/metricollector/internal/server/storage/memory"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamHandler_Stream(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "storage.txt"))
+	require.NoError(t, err)
+
+	storage, err := memory.NewMetricStorage(file, 0, false)
+	require.NoError(t, err)
+
+	b := broker.NewBroker()
+
+	updater := service.NewMetricUpdateService(storage, memory.NewTransactionManager(storage)).WithPublisher(b)
+
+	router := chi.NewMux()
+
+	NewMetricHandler(storage, updater).Register(router)
+	NewStreamHandler(b).Register(router)
+
+	server := httptest.NewServer(router)
+
+	t.Cleanup(func() {
+		server.Close()
+		require.NoError(t, storage.Close())
+		require.NoError(t, file.Close())
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		status, _ := doRequest(t, server, http.MethodGet, "/api/v2/metrics/stream?type=histogram", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = doRequest(t, server, http.MethodGet, "/api/v2/metrics/stream?id=cpu[", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("filtered updates", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v2/metrics/stream?type=counter&id=req*", nil)
+		require.NoError(t, err)
+
+		result, err := server.Client().Do(request)
+		require.NoError(t, err)
+		defer result.Body.Close()
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/event-stream", result.Header.Get("Content-Type"))
+
+		err = updater.Updates(ctx,
+			metric.NewGaugeMetric("requests", 1),
+			metric.NewCounterMetric("errors", 1),
+			metric.NewCounterMetric("requests", 2),
+		)
+		require.NoError(t, err)
+
+		_, err = updater.Update(ctx, metric.NewCounterMetric("requests", 3))
+		require.NoError(t, err)
+
+		reader := bufio.NewReader(result.Body)
+
+		for _, want := range []int64{2, 5} {
+			event, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, "event: metric\n", event)
+
+			data, err := reader.ReadString('\n')
+			require.NoError(t, err)
+
+			var m metric.Metric
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &m))
+			assert.Equal(t, metric.NewCounterMetric("requests", want), m)
+
+			_, err = reader.ReadString('\n')
+			require.NoError(t, err)
+		}
+	})
+}
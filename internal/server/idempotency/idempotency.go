@@ -0,0 +1,18 @@
+// Package idempotency describes responses remembered for requests that
+// carry an Idempotency-Key, so retried deliveries are not applied twice.
+package idempotency
+
+import (
+	"errors"
+)
+
+const Header = "Idempotency-Key"
+
+var ErrInProgress = errors.New("request with the same idempotency key is in progress")
+
+// Result is the response originally returned for a key.
+type Result struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
@@ -0,0 +1,110 @@
+// Package ratelimit keeps a token bucket per client.
+package ratelimit
+
+import (
+	"container/list"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// idleTTL is how long the bucket of a silent client is kept at least.
+// Buckets that take longer to refill are kept until they are full, so
+// dropping an idle bucket never hands a client extra tokens.
+const idleTTL = 10 * time.Minute
+
+// maxBuckets bounds the memory taken by clients that come from many
+// addresses at once.
+const maxBuckets = 1 << 16
+
+type bucket struct {
+	client  string
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+type Limiter struct {
+	mx    sync.Mutex
+	limit rate.Limit
+	burst int
+	idle  time.Duration
+	// buckets index the elements of recent, which lists the buckets from
+	// the most to the least recently seen, so both idle and excess ones
+	// are dropped from its back.
+	buckets map[string]*list.Element
+	recent  *list.List
+	max     int
+	now     func() time.Time
+}
+
+// NewLimiter lets every client make rps requests per second on average
+// and up to burst requests at once.
+func NewLimiter(rps float64, burst int) *Limiter {
+	idle := idleTTL
+
+	if rps > 0 {
+		idle = max(idle, time.Duration(float64(burst)/rps*float64(time.Second)))
+	}
+
+	return &Limiter{
+		limit:   rate.Limit(rps),
+		burst:   burst,
+		idle:    idle,
+		buckets: make(map[string]*list.Element),
+		recent:  list.New(),
+		max:     maxBuckets,
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of client. When it is empty, Allow
+// reports how long the client should wait for the next token.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := l.now()
+
+	var b *bucket
+
+	if e, ok := l.buckets[client]; ok {
+		b = e.Value.(*bucket)
+		l.recent.MoveToFront(e)
+	} else {
+		b = &bucket{client: client, limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[client] = l.recent.PushFront(b)
+	}
+
+	b.seen = now
+
+	l.evict(now)
+
+	res := b.limiter.ReserveN(now, 1)
+	if !res.OK() {
+		return false, time.Second
+	}
+
+	if delay := res.DelayFrom(now); delay > 0 {
+		// the token is not taken by a rejected request
+		res.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// evict drops idle buckets and, while there are too many, the ones of
+// the clients seen last the longest ago. Such a client merely gets a
+// full bucket again.
+func (l *Limiter) evict(now time.Time) {
+	for e := l.recent.Back(); e != nil; e = l.recent.Back() {
+		b := e.Value.(*bucket)
+
+		if len(l.buckets) <= l.max && now.Sub(b.seen) < l.idle {
+			return
+		}
+
+		l.recent.Remove(e)
+		delete(l.buckets, b.client)
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := NewLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok, "request %d is within the burst", i)
+	}
+
+	ok, wait := l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.Allow("b")
+	assert.True(t, ok, "clients have separate buckets")
+
+	now = now.Add(500 * time.Millisecond)
+
+	ok, _ = l.Allow("a")
+	assert.True(t, ok, "a token is refilled")
+
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+
+	t.Run("idle buckets are dropped", func(t *testing.T) {
+		now = now.Add(idleTTL)
+
+		_, _ = l.Allow("c")
+
+		assert.NotContains(t, l.buckets, "a")
+		assert.NotContains(t, l.buckets, "b")
+		assert.Contains(t, l.buckets, "c")
+	})
+
+	t.Run("bucket count is capped", func(t *testing.T) {
+		l := NewLimiter(1, 1)
+		l.now = func() time.Time { return now }
+		l.max = 2
+
+		_, _ = l.Allow("a")
+
+		now = now.Add(time.Second)
+		_, _ = l.Allow("b")
+
+		now = now.Add(time.Second)
+		_, _ = l.Allow("c")
+
+		assert.Len(t, l.buckets, 2)
+		assert.NotContains(t, l.buckets, "a", "the least recently seen client is dropped")
+	})
+
+	t.Run("slow buckets are kept until full", func(t *testing.T) {
+		l := NewLimiter(0.001, 3)
+		l.now = func() time.Time { return now }
+
+		_, _ = l.Allow("a")
+
+		now = now.Add(idleTTL)
+		_, _ = l.Allow("b")
+
+		assert.Contains(t, l.buckets, "a", "the bucket takes longer than idleTTL to refill")
+
+		now = now.Add(time.Hour)
+		_, _ = l.Allow("b")
+
+		assert.NotContains(t, l.buckets, "a")
+	})
+
+	t.Run("zero burst", func(t *testing.T) {
+		ok, wait := NewLimiter(1, 0).Allow("a")
+		assert.False(t, ok)
+		assert.Positive(t, wait)
+	})
+}
@@ -2,58 +2,107 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/baisalov/metricollector/internal/metric"
 )
 
 type MetricUpdateService struct {
-	tm      transactionManager
-	storage MetricStorage
+	tm        transactionManager
+	storage   MetricStorage
+	publisher publisher
 }
 
 func NewMetricUpdateService(storage MetricStorage, tm transactionManager) *MetricUpdateService {
 	return &MetricUpdateService{
-		storage: storage,
-		tm:      tm,
+		storage:   storage,
+		tm:        tm,
+		publisher: discardPublisher{},
 	}
 }
 
+// publisher is notified about metrics once their update is committed.
+type publisher interface {
+	Publish(metrics ...metric.Metric)
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(...metric.Metric) {}
+
+// WithPublisher makes the service announce every committed update to p.
+func (s *MetricUpdateService) WithPublisher(p publisher) *MetricUpdateService {
+	s.publisher = p
+	return s
+}
+
 type transactionManager interface {
 	Do(context.Context, func(context.Context) error) error
 }
 
 type MetricStorage interface {
-	Get(ctx context.Context, t metric.Type, id string) (metric.Metric, error)
 	Save(ctx context.Context, m metric.Metric) error
+	Increment(ctx context.Context, id string, delta int64) (metric.Metric, error)
+}
+
+// batchUpdater is implemented by storages that can apply a whole batch
+// in bulk faster than metric by metric.
+type batchUpdater interface {
+	UpdateBatch(ctx context.Context, metrics ...metric.Metric) ([]metric.Metric, error)
 }
 
 func (s *MetricUpdateService) Updates(ctx context.Context, metrics ...metric.Metric) error {
-	return s.tm.Do(ctx, func(ctx context.Context) error {
+	var updated []metric.Metric
+
+	err := s.tm.Do(ctx, func(ctx context.Context) (err error) {
+		if b, ok := s.storage.(batchUpdater); ok {
+			updated, err = b.UpdateBatch(ctx, metrics...)
+			return err
+		}
+
+		updated = make([]metric.Metric, 0, len(metrics))
+
 		for _, m := range metrics {
-			if _, err := s.Update(ctx, m); err != nil {
+			mm, err := s.update(ctx, m)
+			if err != nil {
 				return err
 			}
+
+			updated = append(updated, mm)
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	s.publisher.Publish(updated...)
+
+	return nil
 }
 
 func (s *MetricUpdateService) Update(ctx context.Context, m metric.Metric) (metric.Metric, error) {
-	mm, err := s.storage.Get(ctx, m.MType, m.ID)
-
+	m, err := s.update(ctx, m)
 	if err != nil {
-		if !errors.Is(err, metric.ErrMetricNotFound) {
-			return m, err
-		}
+		return m, err
 	}
 
-	if m.MType == metric.Counter && mm.Delta != nil {
-		*m.Delta += *mm.Delta
+	s.publisher.Publish(m)
+
+	return m, nil
+}
+
+func (s *MetricUpdateService) update(ctx context.Context, m metric.Metric) (metric.Metric, error) {
+	if m.MType == metric.Counter {
+		mm, err := s.storage.Increment(ctx, m.ID, *m.Delta)
+		if err != nil {
+			return m, fmt.Errorf("can not increment metric: %w", err)
+		}
+
+		return mm, nil
 	}
 
-	err = s.storage.Save(ctx, m)
+	err := s.storage.Save(ctx, m)
 
 	if err != nil {
 		return m, fmt.Errorf("can not save metric: %w", err)
@@ -61,3 +110,14 @@ func (s *MetricUpdateService) Update(ctx context.Context, m metric.Metric) (metr
 
 	return m, nil
 }
+
+// Set stores m as is, replacing the counter total instead of adding to it.
+func (s *MetricUpdateService) Set(ctx context.Context, m metric.Metric) (metric.Metric, error) {
+	if err := s.storage.Save(ctx, m); err != nil {
+		return m, fmt.Errorf("can not save metric: %w", err)
+	}
+
+	s.publisher.Publish(m)
+
+	return m, nil
+}
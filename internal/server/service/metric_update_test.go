@@ -16,68 +16,34 @@ type MetricStorageMock struct {
 	mock.Mock
 }
 
-func (s *MetricStorageMock) Get(ctx context.Context, t metric.Type, name string) (metric.Metric, error) {
-	args := s.Called(ctx, t, name)
-	return args.Get(0).(metric.Metric), args.Error(1)
-}
-
 func (s *MetricStorageMock) Save(ctx context.Context, m metric.Metric) error {
 	args := s.Called(ctx, m)
 	return args.Error(0)
 }
 
+func (s *MetricStorageMock) Increment(ctx context.Context, id string, delta int64) (metric.Metric, error) {
+	args := s.Called(ctx, id, delta)
+	return args.Get(0).(metric.Metric), args.Error(1)
+}
+
 func TestMetricUpdateService_Update(t *testing.T) {
 	ctx := context.Background()
 	mockStorage := new(MetricStorageMock)
 	service := NewMetricUpdateService(mockStorage, transactions.DiscardManager{})
 
-	t.Run("Update existing counter metric", func(t *testing.T) {
-		initialDelta := int64(10)
-		existingDelta := int64(5)
-		expectedDelta := int64(15)
-
-		existingMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "test_count_metric",
-			Delta: &existingDelta,
-		}
-
-		newMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "test_count_metric",
-			Delta: &initialDelta,
-		}
-
-		mockStorage.On("Get", ctx, metric.Counter, "test_count_metric").Return(existingMetric, nil)
-		mockStorage.On("Save", ctx, mock.MatchedBy(func(m metric.Metric) bool { return m.ID == "test_count_metric" })).Return(nil)
-
-		updatedMetric, err := service.Update(ctx, newMetric)
-		assert.NoError(t, err)
-		assert.Equal(t, expectedDelta, *updatedMetric.Delta)
-
-		mockStorage.AssertExpectations(t)
-	})
-
-	t.Run("Save new counter metric", func(t *testing.T) {
-		newDelta := int64(10)
-
-		newMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "new_counter_metric",
-			Delta: &newDelta,
-		}
+	t.Run("Increment counter metric", func(t *testing.T) {
+		newMetric := metric.NewCounterMetric("test_count_metric", 10)
 
-		mockStorage.On("Get", ctx, metric.Counter, "new_counter_metric").Return(metric.Metric{}, metric.ErrMetricNotFound)
-		mockStorage.On("Save", ctx, mock.MatchedBy(func(m metric.Metric) bool { return m.ID == "new_counter_metric" })).Return(nil)
+		mockStorage.On("Increment", ctx, "test_count_metric", int64(10)).Return(metric.NewCounterMetric("test_count_metric", 15), nil)
 
 		updatedMetric, err := service.Update(ctx, newMetric)
 		assert.NoError(t, err)
-		assert.Equal(t, newDelta, *updatedMetric.Delta)
+		assert.Equal(t, int64(15), *updatedMetric.Delta)
 
 		mockStorage.AssertExpectations(t)
 	})
 
-	t.Run("Save new gauge metric", func(t *testing.T) {
+	t.Run("Save gauge metric", func(t *testing.T) {
 		newValue := float64(10)
 
 		newMetric := metric.Metric{
@@ -86,7 +52,6 @@ func TestMetricUpdateService_Update(t *testing.T) {
 			Value: &newValue,
 		}
 
-		mockStorage.On("Get", ctx, metric.Gauge, "new_gauge_metric").Return(metric.Metric{}, metric.ErrMetricNotFound)
 		mockStorage.On("Save", ctx, mock.MatchedBy(func(m metric.Metric) bool { return m.ID == "new_gauge_metric" })).Return(nil)
 
 		updatedMetric, err := service.Update(ctx, newMetric)
@@ -96,74 +61,129 @@ func TestMetricUpdateService_Update(t *testing.T) {
 		mockStorage.AssertExpectations(t)
 	})
 
-	t.Run("Update existing gauge metric", func(t *testing.T) {
-		initialValue := float64(10)
-		existingValue := float64(5)
-		expectedValue := float64(10)
+	t.Run("Fail to increment metric", func(t *testing.T) {
+		newMetric := metric.NewCounterMetric("error_metric", 10)
 
-		existingMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "test_gauge_metric",
-			Value: &existingValue,
-		}
+		mockStorage.On("Increment", ctx, "error_metric", int64(10)).Return(metric.Metric{}, errors.New("unexpected error"))
 
-		newMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "test_gauge_metric",
-			Value: &initialValue,
-		}
+		_, err := service.Update(ctx, newMetric)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unexpected error")
 
-		mockStorage.On("Get", ctx, metric.Counter, "test_gauge_metric").Return(existingMetric, nil)
-		mockStorage.On("Save", ctx, mock.MatchedBy(func(m metric.Metric) bool { return m.ID == "test_gauge_metric" })).Return(nil)
+		mockStorage.AssertExpectations(t)
+	})
 
-		updatedMetric, err := service.Update(ctx, newMetric)
-		assert.NoError(t, err)
-		assert.Equal(t, expectedValue, *updatedMetric.Value)
+	t.Run("Fail to save metric", func(t *testing.T) {
+		newMetric := metric.NewGaugeMetric("fail_save_metric", 10)
+
+		mockStorage.On("Save", ctx, mock.MatchedBy(func(m metric.Metric) bool { return m.ID == "fail_save_metric" })).Return(errors.New("cannot save"))
+
+		_, err := service.Update(ctx, newMetric)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cannot save")
 
 		mockStorage.AssertExpectations(t)
 	})
+}
 
-	t.Run("Fail to get metric due to unexpected error", func(t *testing.T) {
-		newDelta := int64(10)
+type batchStorageMock struct {
+	MetricStorageMock
+}
 
-		newMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "error_metric",
-			Delta: &newDelta,
-		}
+func (s *batchStorageMock) UpdateBatch(ctx context.Context, metrics ...metric.Metric) ([]metric.Metric, error) {
+	args := s.Called(ctx, metrics)
+	return args.Get(0).([]metric.Metric), args.Error(1)
+}
 
-		mockStorage.On("Get", ctx, metric.Counter, "error_metric").Return(metric.Metric{}, errors.New("unexpected error"))
+type publisherMock struct {
+	published []metric.Metric
+}
 
-		_, err := service.Update(ctx, newMetric)
-		assert.Error(t, err)
-		assert.Equal(t, "unexpected error", err.Error())
+func (p *publisherMock) Publish(metrics ...metric.Metric) {
+	p.published = append(p.published, metrics...)
+}
+
+func TestMetricUpdateService_Updates(t *testing.T) {
+	ctx := context.Background()
+
+	metrics := []metric.Metric{
+		metric.NewCounterMetric("counter", 1),
+		metric.NewGaugeMetric("gauge", 2),
+	}
+
+	t.Run("Update metric by metric", func(t *testing.T) {
+		mockStorage := new(MetricStorageMock)
+		service := NewMetricUpdateService(mockStorage, transactions.DiscardManager{})
+
+		mockStorage.On("Increment", ctx, "counter", int64(1)).Return(metrics[0], nil)
+		mockStorage.On("Save", ctx, metrics[1]).Return(nil)
+
+		require.NoError(t, service.Updates(ctx, metrics...))
 
 		mockStorage.AssertExpectations(t)
 	})
 
-	t.Run("Fail to save metric", func(t *testing.T) {
-		initialDelta := int64(10)
-		existingDelta := int64(5)
+	t.Run("Update in bulk", func(t *testing.T) {
+		mockStorage := new(batchStorageMock)
+		service := NewMetricUpdateService(mockStorage, transactions.DiscardManager{})
 
-		existingMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "fail_save_metric",
-			Delta: &existingDelta,
-		}
+		mockStorage.On("UpdateBatch", ctx, metrics).Return(metrics, nil)
 
-		newMetric := metric.Metric{
-			MType: metric.Counter,
-			ID:    "fail_save_metric",
-			Delta: &initialDelta,
-		}
+		require.NoError(t, service.Updates(ctx, metrics...))
 
-		mockStorage.On("Get", ctx, metric.Counter, "fail_save_metric").Return(existingMetric, nil)
-		mockStorage.On("Save", ctx, mock.MatchedBy(func(m metric.Metric) bool { return m.ID == "fail_save_metric" })).Return(errors.New("cannot save"))
+		mockStorage.AssertExpectations(t)
+		mockStorage.AssertNotCalled(t, "Increment", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
 
-		_, err := service.Update(ctx, newMetric)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "cannot save")
+func TestMetricUpdateService_Publish(t *testing.T) {
+	ctx := context.Background()
 
-		mockStorage.AssertExpectations(t)
+	t.Run("Publish committed updates", func(t *testing.T) {
+		mockStorage := new(MetricStorageMock)
+		pub := new(publisherMock)
+		service := NewMetricUpdateService(mockStorage, transactions.DiscardManager{}).WithPublisher(pub)
+
+		total := metric.NewCounterMetric("counter", 7)
+		gauge := metric.NewGaugeMetric("gauge", 2)
+
+		mockStorage.On("Increment", ctx, "counter", int64(1)).Return(total, nil)
+		mockStorage.On("Save", ctx, gauge).Return(nil)
+
+		require.NoError(t, service.Updates(ctx, metric.NewCounterMetric("counter", 1), gauge))
+
+		assert.Equal(t, []metric.Metric{total, gauge}, pub.published)
 	})
+
+	t.Run("Do not publish failed batch", func(t *testing.T) {
+		mockStorage := new(MetricStorageMock)
+		pub := new(publisherMock)
+		service := NewMetricUpdateService(mockStorage, transactions.DiscardManager{}).WithPublisher(pub)
+
+		gauge := metric.NewGaugeMetric("gauge", 2)
+
+		mockStorage.On("Save", ctx, gauge).Return(nil)
+		mockStorage.On("Increment", ctx, "counter", int64(1)).Return(metric.Metric{}, errors.New("unexpected error"))
+
+		require.Error(t, service.Updates(ctx, gauge, metric.NewCounterMetric("counter", 1)))
+
+		assert.Empty(t, pub.published)
+	})
+}
+
+func TestMetricUpdateService_Set(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MetricStorageMock)
+	service := NewMetricUpdateService(mockStorage, transactions.DiscardManager{})
+
+	counter := metric.NewCounterMetric("counter", 5)
+
+	mockStorage.On("Save", ctx, counter).Return(nil)
+
+	m, err := service.Set(ctx, counter)
+	require.NoError(t, err)
+	assert.Equal(t, counter, m)
+
+	mockStorage.AssertNotCalled(t, "Increment", mock.Anything, mock.Anything, mock.Anything)
+	mockStorage.AssertExpectations(t)
 }
@@ -0,0 +1,97 @@
+// Package snapshot implements a portable dump of all metrics that can be
+// moved between storage backends.
+//
+// A snapshot is newline-delimited JSON: a header object followed by one
+// metric per line. Counters carry their totals.
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"io"
+	"time"
+)
+
+const (
+	Format  = "metricollector-snapshot"
+	Version = 1
+)
+
+var ErrUnsupported = errors.New("unsupported snapshot")
+
+type Header struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+type iterator interface {
+	Each(ctx context.Context, fn func(metric.Metric) error) error
+}
+
+// Write dumps every metric of it to w and returns how many were written.
+func Write(ctx context.Context, w io.Writer, it iterator) (int, error) {
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+
+	err := encoder.Encode(Header{Format: Format, Version: Version, Created: time.Now().UTC()})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	err = it.Each(ctx, func(m metric.Metric) error {
+		n++
+		return encoder.Encode(m)
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return n, bw.Flush()
+}
+
+// Read checks the header of the snapshot in r and returns its metrics.
+func Read(r io.Reader) (Header, []metric.Metric, error) {
+	decoder := json.NewDecoder(r)
+
+	var header Header
+
+	if err := decoder.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if header.Format != Format {
+		return header, nil, fmt.Errorf("%w: format %q", ErrUnsupported, header.Format)
+	}
+
+	if header.Version != Version {
+		return header, nil, fmt.Errorf("%w: version %d", ErrUnsupported, header.Version)
+	}
+
+	var metrics []metric.Metric
+
+	for line := 2; ; line++ {
+		var m metric.Metric
+
+		err := decoder.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			return header, metrics, nil
+		}
+
+		if err == nil {
+			err = m.Validate()
+		}
+
+		if err != nil {
+			return header, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		metrics = append(metrics, m)
+	}
+}
@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+type metrics []metric.Metric
+
+func (ms metrics) Each(_ context.Context, fn func(metric.Metric) error) error {
+	for _, m := range ms {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestWriteRead(t *testing.T) {
+	want := metrics{
+		metric.NewCounterMetric("requests", 1<<40),
+		metric.NewGaugeMetric("cpu", 0.25),
+	}
+
+	var buf bytes.Buffer
+
+	n, err := Write(context.Background(), &buf, want)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	header, got, err := Read(&buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, Format, header.Format)
+	assert.Equal(t, Version, header.Version)
+	assert.False(t, header.Created.IsZero())
+	assert.Equal(t, []metric.Metric(want), got)
+}
+
+func TestRead(t *testing.T) {
+	const header = `{"format": "metricollector-snapshot", "version": 1}` + "\n"
+
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"empty snapshot", header, nil},
+		{"unknown format", `{"format": "other", "version": 1}`, ErrUnsupported},
+		{"newer version", `{"format": "metricollector-snapshot", "version": 2}`, ErrUnsupported},
+		{"invalid metric", header + `{"id": "x", "type": "counter"}`, metric.ErrIncorrectValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Read(strings.NewReader(tt.input))
+
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	t.Run("missing header", func(t *testing.T) {
+		_, _, err := Read(strings.NewReader(""))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,153 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"go.etcd.io/bbolt"
+	"io"
+)
+
+var bucketMetrics = []byte("metrics")
+
+type MetricStorage struct {
+	db *bbolt.DB
+}
+
+func NewMetricStorage(db *bbolt.DB) (*MetricStorage, error) {
+	s := &MetricStorage{db: db}
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *MetricStorage) key(t metric.Type, id string) []byte {
+	return []byte(t.String() + "_" + id)
+}
+
+func (s *MetricStorage) Get(ctx context.Context, t metric.Type, id string) (m metric.Metric, err error) {
+	err = s.view(ctx, func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucketMetrics).Get(s.key(t, id))
+		if data == nil {
+			return metric.ErrMetricNotFound
+		}
+
+		return json.Unmarshal(data, &m)
+	})
+
+	if err != nil {
+		return metric.Metric{}, err
+	}
+
+	return m, nil
+}
+
+func (s *MetricStorage) Save(ctx context.Context, m metric.Metric) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to serialize metric: %w", err)
+	}
+
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMetrics).Put(s.key(m.MType, m.ID), data)
+	})
+}
+
+func (s *MetricStorage) Increment(ctx context.Context, id string, delta int64) (m metric.Metric, err error) {
+	err = s.update(ctx, func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketMetrics)
+		key := s.key(metric.Counter, id)
+
+		m = metric.NewCounterMetric(id, delta)
+
+		if data := bucket.Get(key); data != nil {
+			var current metric.Metric
+
+			if err := json.Unmarshal(data, &current); err != nil {
+				return fmt.Errorf("failed to deserialize metric: %w", err)
+			}
+
+			if current.Delta != nil {
+				*m.Delta += *current.Delta
+			}
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to serialize metric: %w", err)
+		}
+
+		return bucket.Put(key, data)
+	})
+
+	if err != nil {
+		return metric.Metric{}, err
+	}
+
+	return m, nil
+}
+
+func (s *MetricStorage) All(ctx context.Context) (metrics []metric.Metric, err error) {
+	err = s.Each(ctx, func(m metric.Metric) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// Each calls fn for every metric in key order within one read
+// transaction. Iteration stops at the first error of fn.
+func (s *MetricStorage) Each(ctx context.Context, fn func(metric.Metric) error) error {
+	return s.view(ctx, func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMetrics).ForEach(func(_, data []byte) error {
+			var m metric.Metric
+
+			if err := json.Unmarshal(data, &m); err != nil {
+				return fmt.Errorf("failed to deserialize metric: %w", err)
+			}
+
+			return fn(m)
+		})
+	})
+}
+
+// Backup writes a consistent copy of the whole database file without
+// blocking concurrent writers. start is given the size of the copy and
+// returns where to write it.
+func (s *MetricStorage) Backup(_ context.Context, start func(size int64) io.Writer) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(start(tx.Size()))
+		return err
+	})
+}
+
+func (s *MetricStorage) view(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	if tx, ok := ctx.Value(ctxTxKey{}).(*bbolt.Tx); ok {
+		return fn(tx)
+	}
+
+	return s.db.View(fn)
+}
+
+func (s *MetricStorage) update(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	if tx, ok := ctx.Value(ctxTxKey{}).(*bbolt.Tx); ok {
+		return fn(tx)
+	}
+
+	return s.db.Update(fn)
+}
+
+func (s *MetricStorage) migrate() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketMetrics)
+		return err
+	})
+}
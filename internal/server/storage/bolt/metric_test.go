@@ -0,0 +1,78 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openDB(t *testing.T) *bbolt.DB {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "metrics.db"), 0600, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	return db
+}
+
+func TestMetricStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		db := openDB(t)
+
+		storage, err := NewMetricStorage(db)
+		require.NoError(t, err)
+
+		return storagetest.Backend{Storage: storage, Transactions: NewTransactionManager(db)}
+	})
+}
+
+func TestMetricStorage_Backup(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := NewMetricStorage(openDB(t))
+	require.NoError(t, err)
+
+	m := metric.NewCounterMetric("counter", 42)
+
+	require.NoError(t, storage.Save(ctx, m))
+
+	var (
+		buf  bytes.Buffer
+		size int64
+	)
+
+	require.NoError(t, storage.Backup(ctx, func(n int64) io.Writer {
+		size = n
+		return &buf
+	}))
+
+	assert.Equal(t, int64(buf.Len()), size)
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+
+	db, err := bbolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+
+	restored, err := NewMetricStorage(db)
+	require.NoError(t, err)
+
+	mm, err := restored.Get(ctx, metric.Counter, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, m, mm)
+}
@@ -0,0 +1,132 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	bucketTokens      = []byte("tokens")
+	bucketTokenHashes = []byte("token_hashes")
+)
+
+// tokenRecord keeps the hash that auth.Token leaves out of its JSON.
+type tokenRecord struct {
+	auth.Token
+	Hash string `json:"hash"`
+}
+
+// TokenStore keeps API tokens by id with an index from secret hash to id.
+type TokenStore struct {
+	db *bbolt.DB
+}
+
+func NewTokenStore(db *bbolt.DB) (*TokenStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		for _, b := range [][]byte{bucketTokens, bucketTokenHashes} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenStore{db: db}, nil
+}
+
+func (s *TokenStore) Create(_ context.Context, t auth.Token) error {
+	data, err := json.Marshal(tokenRecord{Token: t, Hash: t.Hash})
+	if err != nil {
+		return fmt.Errorf("failed to serialize token: %w", err)
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(bucketTokens).Put([]byte(t.ID), data); err != nil {
+			return err
+		}
+
+		return tx.Bucket(bucketTokenHashes).Put([]byte(t.Hash), []byte(t.ID))
+	})
+}
+
+func (s *TokenStore) Find(_ context.Context, hash string) (t auth.Token, err error) {
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(bucketTokenHashes).Get([]byte(hash))
+		if id == nil {
+			return auth.ErrTokenNotFound
+		}
+
+		t, err = getToken(tx, id)
+
+		return err
+	})
+
+	return t, err
+}
+
+func (s *TokenStore) List(_ context.Context) (tokens []auth.Token, err error) {
+	tokens = []auth.Token{}
+
+	err = s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketTokens).ForEach(func(_, data []byte) error {
+			t, err := decodeToken(data)
+			if err != nil {
+				return err
+			}
+
+			tokens = append(tokens, t)
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s *TokenStore) Revoke(_ context.Context, id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		t, err := getToken(tx, []byte(id))
+		if err != nil {
+			return err
+		}
+
+		if err = tx.Bucket(bucketTokenHashes).Delete([]byte(t.Hash)); err != nil {
+			return err
+		}
+
+		return tx.Bucket(bucketTokens).Delete([]byte(id))
+	})
+}
+
+func getToken(tx *bbolt.Tx, id []byte) (auth.Token, error) {
+	data := tx.Bucket(bucketTokens).Get(id)
+	if data == nil {
+		return auth.Token{}, auth.ErrTokenNotFound
+	}
+
+	return decodeToken(data)
+}
+
+func decodeToken(data []byte) (auth.Token, error) {
+	var r tokenRecord
+
+	if err := json.Unmarshal(data, &r); err != nil {
+		return auth.Token{}, fmt.Errorf("failed to deserialize token: %w", err)
+	}
+
+	t := r.Token
+	t.Hash = r.Hash
+
+	return t, nil
+}
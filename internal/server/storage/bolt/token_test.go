@@ -0,0 +1,16 @@
+package bolt
+
+import (
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTokenStore_Conformance(t *testing.T) {
+	storagetest.RunTokens(t, func(t *testing.T) storagetest.TokenStore {
+		s, err := NewTokenStore(openDB(t))
+		require.NoError(t, err)
+
+		return s
+	})
+}
@@ -0,0 +1,26 @@
+package bolt
+
+import (
+	"context"
+	"go.etcd.io/bbolt"
+)
+
+type ctxTxKey struct{}
+
+type TransactionManager struct {
+	db *bbolt.DB
+}
+
+func NewTransactionManager(db *bbolt.DB) *TransactionManager {
+	return &TransactionManager{db: db}
+}
+
+func (m TransactionManager) Do(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := ctx.Value(ctxTxKey{}).(*bbolt.Tx); ok {
+		return fn(ctx)
+	}
+
+	return m.db.Update(func(tx *bbolt.Tx) error {
+		return fn(context.WithValue(ctx, ctxTxKey{}, tx))
+	})
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"sync"
+	"time"
+)
+
+const (
+	// maxIdempotencyKeys bounds the memory taken by remembered responses.
+	// When it is reached the keys closest to expiry are forgotten first.
+	maxIdempotencyKeys = 100_000
+	// idempotencyLease is how long a key stays in progress. A handler that
+	// never completed nor aborted the request, e.g. because it hung, does
+	// not block the key for the whole ttl: after the lease another request
+	// may take it over.
+	idempotencyLease = time.Minute
+)
+
+type idempotencyEntry struct {
+	result  *idempotency.Result
+	begun   time.Time
+	expires time.Time
+	seq     uint64
+}
+
+type queuedKey struct {
+	key     string
+	expires time.Time
+	seq     uint64
+}
+
+type IdempotencyStore struct {
+	mx      sync.Mutex
+	ttl     time.Duration
+	lease   time.Duration
+	max     int
+	entries map[string]idempotencyEntry
+	// queue lists keys in the order they expire. All of them live for
+	// ttl, so appending keeps it sorted. A key stored again is queued
+	// again, and its older place is skipped once reached.
+	queue []queuedKey
+	seq   uint64
+	now   func() time.Time
+}
+
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:     ttl,
+		lease:   idempotencyLease,
+		max:     maxIdempotencyKeys,
+		entries: make(map[string]idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *IdempotencyStore) Begin(_ context.Context, key string) (*idempotency.Result, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := s.now()
+
+	s.evict(now, s.max)
+
+	e, ok := s.entries[key]
+
+	switch {
+	case ok && e.result != nil:
+		return e.result, nil
+	case ok && now.Sub(e.begun) < s.lease:
+		return nil, idempotency.ErrInProgress
+	case !ok:
+		s.evict(now, s.max-1)
+	}
+
+	s.store(key, idempotencyEntry{begun: now, expires: now.Add(s.ttl)})
+
+	return nil, nil
+}
+
+func (s *IdempotencyStore) Complete(_ context.Context, key string, res idempotency.Result) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.store(key, idempotencyEntry{result: &res, expires: s.now().Add(s.ttl)})
+
+	return nil
+}
+
+func (s *IdempotencyStore) Abort(_ context.Context, key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+func (s *IdempotencyStore) store(key string, e idempotencyEntry) {
+	s.seq++
+	e.seq = s.seq
+
+	s.entries[key] = e
+	s.queue = append(s.queue, queuedKey{key, e.expires, e.seq})
+}
+
+// evict forgets expired keys and then the ones closest to expiry until
+// at most n are left.
+func (s *IdempotencyStore) evict(now time.Time, n int) {
+	for len(s.queue) > 0 && (now.After(s.queue[0].expires) || len(s.entries) > n) {
+		q := s.queue[0]
+		s.queue = s.queue[1:]
+
+		if e, ok := s.entries[q.key]; ok && e.seq == q.seq {
+			delete(s.entries, q.key)
+		}
+	}
+}
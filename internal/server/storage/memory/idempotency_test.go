@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore_Conformance(t *testing.T) {
+	storagetest.RunIdempotency(t, func(t *testing.T) storagetest.IdempotencyStore {
+		return NewIdempotencyStore(time.Minute)
+	})
+}
+
+func TestIdempotencyStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newStore := func() *IdempotencyStore {
+		s := NewIdempotencyStore(time.Minute)
+		s.now = func() time.Time { return now }
+
+		return s
+	}
+
+	t.Run("expired keys are forgotten", func(t *testing.T) {
+		s := newStore()
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+
+		now = now.Add(30 * time.Second)
+
+		require.NoError(t, s.Complete(ctx, "a", idempotency.Result{Status: 200}))
+
+		_, err = s.Begin(ctx, "b")
+		require.NoError(t, err)
+
+		now = now.Add(45 * time.Second)
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		assert.NotNil(t, res, "completing a key renews it")
+
+		now = now.Add(time.Minute)
+
+		res, err = s.Begin(ctx, "a")
+		require.NoError(t, err)
+		assert.Nil(t, res)
+
+		assert.NotContains(t, s.entries, "b")
+		assert.Len(t, s.queue, 1, "stale places are dropped")
+	})
+
+	t.Run("lapsed lease is taken over", func(t *testing.T) {
+		s := newStore()
+		s.lease = 10 * time.Second
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+
+		now = now.Add(5 * time.Second)
+
+		_, err = s.Begin(ctx, "a")
+		assert.ErrorIs(t, err, idempotency.ErrInProgress)
+
+		now = now.Add(5 * time.Second)
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		assert.Nil(t, res, "the key was never completed")
+
+		_, err = s.Begin(ctx, "a")
+		assert.ErrorIs(t, err, idempotency.ErrInProgress, "the new owner holds a fresh lease")
+	})
+
+	t.Run("size is capped", func(t *testing.T) {
+		s := newStore()
+		s.max = 3
+
+		for i := 0; i < 5; i++ {
+			now = now.Add(time.Second)
+
+			_, err := s.Begin(ctx, strconv.Itoa(i))
+			require.NoError(t, err)
+		}
+
+		assert.Len(t, s.entries, 3)
+		assert.NotContains(t, s.entries, "0")
+		assert.NotContains(t, s.entries, "1")
+
+		_, err := s.Begin(ctx, "4")
+		assert.ErrorIs(t, err, idempotency.ErrInProgress, "a known key does not evict others")
+		assert.Len(t, s.entries, 3)
+	})
+
+}
@@ -64,12 +64,17 @@ func (s *MetricStorage) key(t metric.Type, id string) string {
 	return t.String() + "_" + id
 }
 
-func (s *MetricStorage) Get(_ context.Context, t metric.Type, id string) (metric.Metric, error) {
+func (s *MetricStorage) Get(ctx context.Context, t metric.Type, id string) (metric.Metric, error) {
+	key := s.key(t, id)
+
 	s.mx.RLock()
+	m, ok := s.metrics[key]
+	s.mx.RUnlock()
 
-	defer s.mx.RUnlock()
+	if tx, isTx := ctx.Value(ctxTxKey{}).(*tx); isTx {
+		m, ok = tx.resolve(key, m, ok)
+	}
 
-	m, ok := s.metrics[s.key(t, id)]
 	if !ok {
 		return metric.Metric{}, metric.ErrMetricNotFound
 	}
@@ -77,7 +82,12 @@ func (s *MetricStorage) Get(_ context.Context, t metric.Type, id string) (metric
 	return m, nil
 }
 
-func (s *MetricStorage) Save(_ context.Context, m metric.Metric) error {
+func (s *MetricStorage) Save(ctx context.Context, m metric.Metric) error {
+	if tx, ok := ctx.Value(ctxTxKey{}).(*tx); ok {
+		tx.save(s.key(m.MType, m.ID), m)
+		return nil
+	}
+
 	s.mx.Lock()
 
 	s.metrics[s.key(m.MType, m.ID)] = m
@@ -91,20 +101,100 @@ func (s *MetricStorage) Save(_ context.Context, m metric.Metric) error {
 	return nil
 }
 
-func (s *MetricStorage) All(_ context.Context) ([]metric.Metric, error) {
+// Increment adds delta to the counter under the storage write lock, so
+// concurrent increments of the same counter are never lost.
+func (s *MetricStorage) Increment(ctx context.Context, id string, delta int64) (metric.Metric, error) {
+	key := s.key(metric.Counter, id)
+
+	if tx, ok := ctx.Value(ctxTxKey{}).(*tx); ok {
+		tx.increment(key, id, delta)
+		return s.Get(ctx, metric.Counter, id)
+	}
+
+	s.mx.Lock()
+
+	current, ok := s.metrics[key]
+	m := increment(current, ok, metric.NewCounterMetric(id, delta))
+	s.metrics[key] = m
+
+	s.mx.Unlock()
+
+	if s.syncArchive {
+		return m, s.archive()
+	}
+
+	return m, nil
+}
+
+func (s *MetricStorage) All(ctx context.Context) ([]metric.Metric, error) {
 	s.mx.RLock()
 
-	defer s.mx.RUnlock()
+	all := make(map[string]metric.Metric, len(s.metrics))
+	maps.Copy(all, s.metrics)
 
-	metrics := make([]metric.Metric, 0, len(s.metrics))
+	s.mx.RUnlock()
 
-	for _, m := range s.metrics {
+	if tx, ok := ctx.Value(ctxTxKey{}).(*tx); ok {
+		for _, key := range tx.keys() {
+			m, found := all[key]
+			all[key], _ = tx.resolve(key, m, found)
+		}
+	}
+
+	metrics := make([]metric.Metric, 0, len(all))
+
+	for _, m := range all {
 		metrics = append(metrics, m)
 	}
 
 	return metrics, nil
 }
 
+// Each calls fn for every metric. It works on a snapshot so that a slow
+// fn does not hold the storage lock. Iteration stops at the first error
+// of fn.
+func (s *MetricStorage) Each(ctx context.Context, fn func(metric.Metric) error) error {
+	metrics, err := s.All(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metrics {
+		if err = fn(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *MetricStorage) commit(tx *tx) error {
+	s.mx.Lock()
+
+	for _, key := range tx.keys() {
+		m, found := s.metrics[key]
+		s.metrics[key], _ = tx.resolve(key, m, found)
+	}
+
+	s.mx.Unlock()
+
+	if s.syncArchive {
+		return s.archive()
+	}
+
+	return nil
+}
+
+func increment(base metric.Metric, found bool, d metric.Metric) metric.Metric {
+	delta := *d.Delta
+
+	if found && base.Delta != nil {
+		delta += *base.Delta
+	}
+
+	return metric.NewCounterMetric(d.ID, delta)
+}
+
 func (s *MetricStorage) restore() error {
 	var metrics map[string]metric.Metric
 
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetricStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		file, err := os.Create(filepath.Join(t.TempDir(), "storage.txt"))
+		require.NoError(t, err)
+
+		storage, err := NewMetricStorage(file, 0, false)
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			require.NoError(t, storage.Close())
+			require.NoError(t, file.Close())
+		})
+
+		return storagetest.Backend{Storage: storage, Transactions: NewTransactionManager(storage)}
+	})
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tokenRecord keeps the hash that auth.Token leaves out of its JSON.
+type tokenRecord struct {
+	auth.Token
+	Hash string `json:"hash"`
+}
+
+// TokenStore keeps API tokens in memory and, when a path is given, in a
+// JSON file that is rewritten on every change.
+type TokenStore struct {
+	mx     sync.RWMutex
+	path   string
+	tokens map[string]tokenRecord
+}
+
+func NewTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{
+		path:   path,
+		tokens: make(map[string]tokenRecord),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+
+	var records []tokenRecord
+
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("failed to deserialize tokens: %w", err)
+		}
+	}
+
+	for _, r := range records {
+		s.tokens[r.ID] = r
+	}
+
+	return s, nil
+}
+
+func (s *TokenStore) Create(_ context.Context, t auth.Token) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.tokens[t.ID] = tokenRecord{Token: t, Hash: t.Hash}
+
+	return s.archive()
+}
+
+func (s *TokenStore) Find(_ context.Context, hash string) (auth.Token, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	for _, r := range s.tokens {
+		if r.Hash == hash {
+			return r.token(), nil
+		}
+	}
+
+	return auth.Token{}, auth.ErrTokenNotFound
+}
+
+func (s *TokenStore) List(_ context.Context) ([]auth.Token, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	tokens := make([]auth.Token, 0, len(s.tokens))
+
+	for _, r := range s.tokens {
+		tokens = append(tokens, r.token())
+	}
+
+	slices.SortFunc(tokens, func(a, b auth.Token) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return tokens, nil
+}
+
+func (s *TokenStore) Revoke(_ context.Context, id string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.tokens[id]; !ok {
+		return auth.ErrTokenNotFound
+	}
+
+	delete(s.tokens, id)
+
+	return s.archive()
+}
+
+func (r tokenRecord) token() auth.Token {
+	t := r.Token
+	t.Hash = r.Hash
+
+	return t
+}
+
+// archive replaces the file through a rename so a crash never leaves a
+// half-written token list behind.
+func (s *TokenStore) archive() error {
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]tokenRecord, 0, len(s.tokens))
+
+	for _, r := range s.tokens {
+		records = append(records, r)
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to serialize tokens: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write tokens file: %w", err)
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace tokens file: %w", err)
+	}
+
+	return nil
+}
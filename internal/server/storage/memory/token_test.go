@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenStore_Conformance(t *testing.T) {
+	storagetest.RunTokens(t, func(t *testing.T) storagetest.TokenStore {
+		s, err := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+		require.NoError(t, err)
+
+		return s
+	})
+}
+
+func TestTokenStore_Persistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+
+	s, err := NewTokenStore(path)
+	require.NoError(t, err)
+
+	kept, secret, err := auth.Issue("kept", []auth.Scope{auth.ScopeRead})
+	require.NoError(t, err)
+
+	revoked, _, err := auth.Issue("revoked", []auth.Scope{auth.ScopeWrite})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Create(ctx, kept))
+	require.NoError(t, s.Create(ctx, revoked))
+	require.NoError(t, s.Revoke(ctx, revoked.ID))
+
+	s, err = NewTokenStore(path)
+	require.NoError(t, err)
+
+	got, err := s.Find(ctx, auth.Hash(secret))
+	require.NoError(t, err)
+	assert.Equal(t, kept.ID, got.ID)
+
+	tokens, err := s.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+}
@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/metric"
+	"sync"
+)
+
+type ctxTxKey struct{}
+
+// tx is an overlay of writes that are invisible outside the transaction
+// until they are committed to the storage. Counter increments are kept
+// as deltas so that they are applied on top of the value current at
+// commit time rather than the one read inside the transaction.
+type tx struct {
+	mx     sync.RWMutex
+	writes map[string]metric.Metric
+	deltas map[string]metric.Metric
+}
+
+func newTx() *tx {
+	return &tx{
+		writes: make(map[string]metric.Metric),
+		deltas: make(map[string]metric.Metric),
+	}
+}
+
+func (t *tx) save(key string, m metric.Metric) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	t.writes[key] = m
+	delete(t.deltas, key)
+}
+
+func (t *tx) increment(key string, id string, delta int64) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	d, ok := t.deltas[key]
+	t.deltas[key] = increment(d, ok, metric.NewCounterMetric(id, delta))
+}
+
+func (t *tx) resolve(key string, base metric.Metric, found bool) (metric.Metric, bool) {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	if m, ok := t.writes[key]; ok {
+		base, found = m, true
+	}
+
+	if d, ok := t.deltas[key]; ok {
+		base, found = increment(base, found, d), true
+	}
+
+	return base, found
+}
+
+func (t *tx) keys() []string {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	keys := make([]string, 0, len(t.writes)+len(t.deltas))
+
+	for k := range t.writes {
+		keys = append(keys, k)
+	}
+
+	for k := range t.deltas {
+		if _, ok := t.writes[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+type TransactionManager struct {
+	mx      *sync.Mutex
+	storage *MetricStorage
+}
+
+func NewTransactionManager(storage *MetricStorage) *TransactionManager {
+	return &TransactionManager{
+		mx:      &sync.Mutex{},
+		storage: storage,
+	}
+}
+
+func (m TransactionManager) Do(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := ctx.Value(ctxTxKey{}).(*tx); ok {
+		return fn(ctx)
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	t := newTx()
+
+	if err := fn(context.WithValue(ctx, ctxTxKey{}, t)); err != nil {
+		return err
+	}
+
+	return m.storage.commit(t)
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"sync"
+	"time"
+)
+
+const (
+	// idempotencyLease is how long a key stays in progress. A server that
+	// crashed while handling the request never completes it, so after the
+	// lease another request may take the key over.
+	idempotencyLease = time.Minute
+	// idempotencyPurge is how often expired keys are deleted.
+	idempotencyPurge = time.Minute
+)
+
+type IdempotencyStore struct {
+	db    *sql.DB
+	ttl   time.Duration
+	lease time.Duration
+
+	mx     sync.Mutex
+	purged time.Time
+}
+
+func NewIdempotencyStore(db *sql.DB, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{db: db, ttl: ttl, lease: idempotencyLease}
+}
+
+// Begin claims the key, or reports how it is held. An expired key, or
+// one whose lease ran out before it was completed, is claimed in place.
+func (s *IdempotencyStore) Begin(ctx context.Context, key string) (*idempotency.Result, error) {
+	now := time.Now()
+
+	if err := s.purge(ctx, now); err != nil {
+		return nil, err
+	}
+
+	var res sql.Result
+
+	err := retry(func() error {
+		var err error
+
+		res, err = s.db.ExecContext(ctx, `INSERT INTO idempotency_keys ("key", "created_at") VALUES ($1, $2)
+			ON CONFLICT ("key") DO UPDATE SET "status" = NULL, "content_type" = NULL, "body" = NULL, "created_at" = $2
+			WHERE idempotency_keys."created_at" < $3
+				OR idempotency_keys."status" IS NULL AND idempotency_keys."created_at" < $4`,
+			key, now, now.Add(-s.ttl), now.Add(-s.lease))
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return nil, err
+	}
+
+	var (
+		status      sql.NullInt64
+		contentType sql.NullString
+		body        []byte
+	)
+
+	err = retry(func() error {
+		return s.db.QueryRowContext(ctx, `SELECT "status", "content_type", "body" FROM idempotency_keys WHERE "key" = $1`, key).
+			Scan(&status, &contentType, &body)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !status.Valid {
+		return nil, idempotency.ErrInProgress
+	}
+
+	return &idempotency.Result{
+		Status:      int(status.Int64),
+		ContentType: contentType.String,
+		Body:        body,
+	}, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, res idempotency.Result) error {
+	return retry(func() error {
+		_, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET "status" = $2, "content_type" = $3, "body" = $4 WHERE "key" = $1`,
+			key, res.Status, res.ContentType, res.Body)
+		return err
+	})
+}
+
+func (s *IdempotencyStore) Abort(ctx context.Context, key string) error {
+	return retry(func() error {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE "key" = $1`, key)
+		return err
+	})
+}
+
+// purge deletes expired keys at most once per idempotencyPurge. Begin
+// does not depend on it, it only keeps the table from growing.
+func (s *IdempotencyStore) purge(ctx context.Context, now time.Time) error {
+	s.mx.Lock()
+
+	if now.Sub(s.purged) < idempotencyPurge {
+		s.mx.Unlock()
+		return nil
+	}
+
+	s.purged = now
+	s.mx.Unlock()
+
+	return retry(func() error {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE "created_at" < $1`, now.Add(-s.ttl))
+		return err
+	})
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore_Conformance(t *testing.T) {
+	db, _ := openStorage(t)
+
+	storagetest.RunIdempotency(t, func(t *testing.T) storagetest.IdempotencyStore {
+		_, err := db.Exec(`TRUNCATE TABLE idempotency_keys`)
+		require.NoError(t, err)
+
+		return NewIdempotencyStore(db, time.Minute)
+	})
+}
+
+func TestIdempotencyStore_Expiry(t *testing.T) {
+	db, _ := openStorage(t)
+	ctx := context.Background()
+
+	reset := func(t *testing.T) *IdempotencyStore {
+		_, err := db.Exec(`TRUNCATE TABLE idempotency_keys`)
+		require.NoError(t, err)
+
+		return NewIdempotencyStore(db, time.Hour)
+	}
+
+	age := func(t *testing.T, key string, d time.Duration) {
+		_, err := db.Exec(`UPDATE idempotency_keys SET "created_at" = "created_at" - make_interval(secs => $2) WHERE "key" = $1`, key, d.Seconds())
+		require.NoError(t, err)
+	}
+
+	t.Run("lease of a key left in progress runs out", func(t *testing.T) {
+		s := reset(t)
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+
+		_, err = s.Begin(ctx, "a")
+		require.ErrorIs(t, err, idempotency.ErrInProgress)
+
+		age(t, "a", 2*idempotencyLease)
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		assert.Nil(t, res, "the key is taken over")
+
+		_, err = s.Begin(ctx, "a")
+		assert.ErrorIs(t, err, idempotency.ErrInProgress, "the takeover starts a new lease")
+	})
+
+	t.Run("completed key outlives the lease", func(t *testing.T) {
+		s := reset(t)
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, s.Complete(ctx, "a", idempotency.Result{Status: 200}))
+
+		age(t, "a", 2*idempotencyLease)
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		assert.Equal(t, 200, res.Status)
+	})
+
+	t.Run("expired key is claimed again", func(t *testing.T) {
+		s := reset(t)
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, s.Complete(ctx, "a", idempotency.Result{Status: 200}))
+
+		age(t, "a", 2*time.Hour)
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("expired keys are purged", func(t *testing.T) {
+		s := reset(t)
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+
+		age(t, "a", 2*time.Hour)
+
+		s.purged = time.Time{}
+
+		_, err = s.Begin(ctx, "b")
+		require.NoError(t, err)
+
+		var n int
+		require.NoError(t, db.QueryRow(`SELECT count(*) FROM idempotency_keys`).Scan(&n))
+		assert.Equal(t, 1, n)
+	})
+}
@@ -1,11 +1,14 @@
 package postgres
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/baisalov/metricollector/internal/metric"
+	"slices"
+	"strings"
 )
 
 type MetricStorage struct {
@@ -23,7 +26,21 @@ func NewMetricStorage(db *sql.DB) (*MetricStorage, error) {
 }
 
 func (s MetricStorage) All(ctx context.Context) (metrics []metric.Metric, err error) {
-	query := `SELECT "type", "id", "delta", "value" FROM metrics WHERE true`
+	err = s.Each(ctx, func(m metric.Metric) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// Each calls fn for every metric, ordered by type and id, while reading
+// the rows from the database. Iteration stops at the first error of fn.
+func (s MetricStorage) Each(ctx context.Context, fn func(metric.Metric) error) (err error) {
+	query := `SELECT "type", "id", "delta", "value" FROM metrics ORDER BY "type", "id"`
 
 	var rows *sql.Rows
 
@@ -34,7 +51,7 @@ func (s MetricStorage) All(ctx context.Context) (metrics []metric.Metric, err er
 	}
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	defer func() {
@@ -47,18 +64,15 @@ func (s MetricStorage) All(ctx context.Context) (metrics []metric.Metric, err er
 		var r rowMetric
 		err = rows.Scan(&r.MType, &r.ID, &r.Delta, &r.Value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		metrics = append(metrics, r.metric())
-	}
-
-	err = rows.Err()
-	if err != nil {
-		return nil, err
+		if err = fn(r.metric()); err != nil {
+			return err
+		}
 	}
 
-	return metrics, nil
+	return rows.Err()
 }
 
 func (s MetricStorage) Get(ctx context.Context, t metric.Type, id string) (m metric.Metric, err error) {
@@ -137,6 +151,139 @@ func (s MetricStorage) Save(ctx context.Context, m metric.Metric) error {
 	return err
 }
 
+func (s MetricStorage) Increment(ctx context.Context, id string, delta int64) (m metric.Metric, err error) {
+	query := `INSERT INTO metrics ("type", "id", "delta") VALUES ($1, $2, $3)
+		ON CONFLICT ("type", "id") DO UPDATE SET "delta"=COALESCE("metrics"."delta", 0)+"excluded"."delta"
+		RETURNING "type", "id", "delta", "value"`
+
+	var stmt *sql.Stmt
+
+	err = retry(func() error {
+		stmt, err = s.db.PrepareContext(ctx, query)
+		return err
+	})
+	if err != nil {
+		return metric.Metric{}, fmt.Errorf("failed to make statmant: %w", err)
+	}
+
+	defer func() {
+		if r := stmt.Close(); r != nil {
+			err = errors.Join(err, r)
+		}
+	}()
+
+	if tx, ok := ctx.Value(ctxTxKey{}).(*sql.Tx); ok {
+		stmt = tx.StmtContext(ctx, stmt)
+	}
+
+	var r rowMetric
+
+	err = retry(func() error {
+		return stmt.QueryRowContext(ctx, metric.Counter, id, delta).Scan(&r.MType, &r.ID, &r.Delta, &r.Value)
+	})
+	if err != nil {
+		return metric.Metric{}, err
+	}
+
+	return r.metric(), nil
+}
+
+// batchSize keeps a single statement well below the 65535 bind
+// parameters postgres accepts.
+const batchSize = 1000
+
+// UpdateBatch applies the whole batch with multi-row upserts: counters
+// are incremented and gauges overwritten. Duplicate ids are merged
+// beforehand because one statement cannot update the same row twice.
+// The rows are locked in (type, id) order, so concurrent batches naming
+// the same metrics in another order wait for each other instead of
+// deadlocking. The stored state of every touched metric is returned.
+func (s MetricStorage) UpdateBatch(ctx context.Context, metrics ...metric.Metric) ([]metric.Metric, error) {
+	metrics = metric.Merge(metrics...)
+
+	slices.SortFunc(metrics, func(a, b metric.Metric) int {
+		return cmp.Or(cmp.Compare(a.MType, b.MType), cmp.Compare(a.ID, b.ID))
+	})
+
+	updated := make([]metric.Metric, 0, len(metrics))
+
+	for len(metrics) > 0 {
+		n := min(len(metrics), batchSize)
+
+		res, err := s.upsert(ctx, metrics[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		updated = append(updated, res...)
+		metrics = metrics[n:]
+	}
+
+	return updated, nil
+}
+
+func (s MetricStorage) upsert(ctx context.Context, metrics []metric.Metric) (updated []metric.Metric, err error) {
+	var query strings.Builder
+
+	query.WriteString(`INSERT INTO metrics ("type", "id", "delta", "value") VALUES `)
+
+	args := make([]any, 0, len(metrics)*4)
+
+	for i, m := range metrics {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+
+		n := len(args)
+
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+
+		args = append(args, m.MType, m.ID, m.Delta, m.Value)
+	}
+
+	query.WriteString(` ON CONFLICT ("type", "id") DO UPDATE SET
+		"delta"=CASE WHEN "excluded"."type"='counter' THEN COALESCE("metrics"."delta", 0)+"excluded"."delta" ELSE "excluded"."delta" END,
+		"value"="excluded"."value"
+		RETURNING "type", "id", "delta", "value"`)
+
+	var rows *sql.Rows
+
+	err = retry(func() error {
+		if tx, ok := ctx.Value(ctxTxKey{}).(*sql.Tx); ok {
+			rows, err = tx.QueryContext(ctx, query.String(), args...)
+		} else {
+			rows, err = s.db.QueryContext(ctx, query.String(), args...)
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := rows.Close(); r != nil {
+			err = errors.Join(err, r)
+		}
+	}()
+
+	for rows.Next() {
+		var r rowMetric
+
+		if err = rows.Scan(&r.MType, &r.ID, &r.Delta, &r.Value); err != nil {
+			return nil, err
+		}
+
+		updated = append(updated, r.metric())
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
 type rowMetric struct {
 	ID    string
 	MType string
@@ -162,18 +309,10 @@ func (r rowMetric) metric() metric.Metric {
 }
 
 func (s MetricStorage) migrate() error {
-	shame := `CREATE TABLE IF NOT EXISTS metrics (
-    "type" VARCHAR(30) NOT NULL,
-    "id" VARCHAR(30) NOT NULL,
-    "delta" BIGINT,
-    "value" DOUBLE PRECISION,
-    PRIMARY KEY ("type", "id")
-	);`
-
-	err := retry(func() error {
-		_, err := s.db.Exec(shame)
+	m, err := NewMigrator(s.db)
+	if err != nil {
 		return err
-	})
+	}
 
-	return err
+	return m.Up(context.Background())
 }
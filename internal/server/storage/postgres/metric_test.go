@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TEST_DATABASE_DSN points at a disposable database, e.g. the postgres
+// service started for the unit tests workflow. The metrics table is
+// truncated before every case.
+const envTestDatabaseDsn = "TEST_DATABASE_DSN"
+
+func openStorage(t *testing.T) (*sql.DB, *MetricStorage) {
+	dsn := os.Getenv(envTestDatabaseDsn)
+	if dsn == "" {
+		t.Skipf("%s is not set", envTestDatabaseDsn)
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	require.NoError(t, err)
+
+	db := stdlib.OpenDBFromPool(pool)
+
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	storage, err := NewMetricStorage(db)
+	require.NoError(t, err)
+
+	return db, storage
+}
+
+func truncate(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`TRUNCATE TABLE metrics`)
+	require.NoError(t, err)
+}
+
+func TestMetricStorage_Conformance(t *testing.T) {
+	db, storage := openStorage(t)
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Backend {
+		truncate(t, db)
+
+		return storagetest.Backend{Storage: storage, Transactions: NewTransactionManager(db)}
+	})
+}
+
+func TestMetricStorage_UpdateBatch(t *testing.T) {
+	db, storage := openStorage(t)
+	truncate(t, db)
+
+	ctx := context.Background()
+
+	require.NoError(t, storage.Save(ctx, metric.NewCounterMetric("counter", 10)))
+
+	n := batchSize*2 + 1
+
+	var batch []metric.Metric
+
+	for i := 0; i < n; i++ {
+		batch = append(batch,
+			metric.NewCounterMetric("counter", 1),
+			metric.NewGaugeMetric(fmt.Sprintf("gauge_%d", i), float64(i)),
+			metric.NewGaugeMetric("gauge", float64(i)))
+	}
+
+	updated, err := storage.UpdateBatch(ctx, batch...)
+	require.NoError(t, err)
+	assert.Len(t, updated, n+2)
+
+	assert.Contains(t, updated, metric.NewCounterMetric("counter", int64(10+n)))
+
+	m, err := storage.Get(ctx, metric.Counter, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10+n), *m.Delta)
+
+	m, err = storage.Get(ctx, metric.Gauge, "gauge")
+	require.NoError(t, err)
+	assert.Equal(t, float64(n-1), *m.Value)
+
+	all, err := storage.All(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, n+2)
+}
+
+func TestMetricStorage_UpdateBatch_Concurrent(t *testing.T) {
+	db, storage := openStorage(t)
+	truncate(t, db)
+
+	ctx := context.Background()
+	tm := NewTransactionManager(db)
+
+	const (
+		workers = 8
+		ids     = 50
+	)
+
+	var wg sync.WaitGroup
+
+	// every worker names the same counters, half of them in reverse, the
+	// way agents report: rows locked in batch order would deadlock
+	for w := 0; w < workers; w++ {
+		batch := make([]metric.Metric, 0, ids)
+
+		for i := 0; i < ids; i++ {
+			batch = append(batch, metric.NewCounterMetric(fmt.Sprintf("counter_%d", i), 1))
+		}
+
+		if w%2 == 1 {
+			slices.Reverse(batch)
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := tm.Do(ctx, func(ctx context.Context) error {
+				_, err := storage.UpdateBatch(ctx, batch...)
+				return err
+			})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	m, err := storage.Get(ctx, metric.Counter, "counter_0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers), *m.Delta)
+}
@@ -0,0 +1,230 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID is the pg_advisory_lock key held while migrating, so
+// replicas starting at the same time apply every migration only once.
+const migrationLockID = 7_263_540_118
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, current int) error {
+		for _, mg := range m.migrations {
+			if mg.version <= current {
+				continue
+			}
+
+			err := m.apply(ctx, conn, mg.up, `INSERT INTO schema_migrations ("version") VALUES ($1)`, mg.version)
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %04d_%s: %w", mg.version, mg.name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(conn *sql.Conn, current int) error {
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mg := m.migrations[i]
+
+			if mg.version > current {
+				continue
+			}
+
+			err := m.apply(ctx, conn, mg.down, `DELETE FROM schema_migrations WHERE "version" = $1`, mg.version)
+			if err != nil {
+				return fmt.Errorf("failed to revert migration %04d_%s: %w", mg.version, mg.name, err)
+			}
+
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Version returns the latest applied migration, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (version int, err error) {
+	err = m.locked(ctx, func(_ *sql.Conn, current int) error {
+		version = current
+		return nil
+	})
+
+	return version, err
+}
+
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, current int) error) (err error) {
+	var conn *sql.Conn
+
+	err = retry(func() error {
+		conn, err = m.db.Conn(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	defer func() {
+		if r := conn.Close(); r != nil {
+			err = errors.Join(err, r)
+		}
+	}()
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+
+	defer func() {
+		if _, r := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); r != nil {
+			err = errors.Join(err, fmt.Errorf("failed to release migration lock: %w", r))
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    "version" INTEGER PRIMARY KEY,
+    "applied_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX("version"), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	return fn(conn, current)
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script, record string, version int) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			if r := tx.Rollback(); r != nil {
+				err = errors.Join(err, fmt.Errorf("failed to rollback transaction: %w", r))
+			}
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, record, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadMigrations reads NNNN_name.up.sql / NNNN_name.down.sql pairs.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+
+	for _, file := range files {
+		base := path.Base(file)
+
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file name %q", base)
+		}
+
+		number, name, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("unexpected migration file name %q", base)
+		}
+
+		version, err := strconv.Atoi(number)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("incorrect migration version %q", base)
+		}
+
+		script, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &migration{version: version, name: name}
+			byVersion[version] = mg
+		}
+
+		if direction == "up" {
+			mg.up = string(script)
+		} else {
+			mg.down = string(script)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+
+	for _, mg := range byVersion {
+		if mg.up == "" || mg.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down scripts", mg.version, mg.name)
+		}
+
+		migrations = append(migrations, *mg)
+	}
+
+	slices.SortFunc(migrations, func(a, b migration) int {
+		return a.version - b.version
+	})
+
+	for i, mg := range migrations {
+		if mg.version != i+1 {
+			return nil, fmt.Errorf("missing migration %04d", i+1)
+		}
+	}
+
+	return migrations, nil
+}
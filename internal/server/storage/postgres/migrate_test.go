@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("embedded", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationsFS)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		for i, mg := range migrations {
+			assert.Equal(t, i+1, mg.version)
+			assert.NotEmpty(t, mg.up)
+			assert.NotEmpty(t, mg.down)
+		}
+	})
+
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			"missing down",
+			fstest.MapFS{
+				"migrations/0001_init.up.sql": {Data: []byte("SELECT 1")},
+			},
+		},
+		{
+			"gap in versions",
+			fstest.MapFS{
+				"migrations/0001_init.up.sql":   {Data: []byte("SELECT 1")},
+				"migrations/0001_init.down.sql": {Data: []byte("SELECT 1")},
+				"migrations/0003_next.up.sql":   {Data: []byte("SELECT 1")},
+				"migrations/0003_next.down.sql": {Data: []byte("SELECT 1")},
+			},
+		},
+		{
+			"incorrect name",
+			fstest.MapFS{
+				"migrations/init.sql": {Data: []byte("SELECT 1")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db, _ := openStorage(t)
+	ctx := context.Background()
+
+	m, err := NewMigrator(db)
+	require.NoError(t, err)
+
+	latest := len(m.migrations)
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	require.NoError(t, m.Down(ctx, 1))
+
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest-1, version)
+
+	require.NoError(t, m.Up(ctx))
+
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, latest, version)
+}
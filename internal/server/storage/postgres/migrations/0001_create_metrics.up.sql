@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS metrics (
+    "type" VARCHAR(30) NOT NULL,
+    "id" VARCHAR(30) NOT NULL,
+    "delta" BIGINT,
+    "value" DOUBLE PRECISION,
+    PRIMARY KEY ("type", "id")
+);
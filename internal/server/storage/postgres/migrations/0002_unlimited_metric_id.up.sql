@@ -0,0 +1 @@
+ALTER TABLE metrics ALTER COLUMN "id" TYPE TEXT;
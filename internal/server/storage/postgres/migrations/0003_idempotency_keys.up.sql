@@ -0,0 +1,9 @@
+CREATE TABLE idempotency_keys (
+    "key" TEXT PRIMARY KEY,
+    "status" INTEGER,
+    "content_type" TEXT,
+    "body" BYTEA,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys ("created_at");
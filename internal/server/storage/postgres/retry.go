@@ -2,6 +2,8 @@ package postgres
 
 import (
 	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"time"
@@ -17,8 +19,12 @@ func retry(fn func() error) error {
 
 		var pgErr *pgconn.PgError
 
-		if err == nil || !errors.As(err, &pgErr) || !pgerrcode.IsConnectionException(pgErr.Code) || i > n {
-			return err
+		if err == nil || !errors.As(err, &pgErr) || !pgerrcode.IsConnectionException(pgErr.Code) {
+			return unavailable(err)
+		}
+
+		if i > n {
+			return fmt.Errorf("%w: %w", metric.ErrStorageUnavailable, err)
 		}
 
 		time.Sleep(time.Duration(i+(i-1)) * time.Second)
@@ -26,3 +32,15 @@ func retry(fn func() error) error {
 		i++
 	}
 }
+
+// unavailable marks errors of an unreachable database, so callers can
+// tell them apart from query errors.
+func unavailable(err error) error {
+	var connErr *pgconn.ConnectError
+
+	if errors.As(err, &connErr) || pgconn.Timeout(err) {
+		return fmt.Errorf("%w: %w", metric.ErrStorageUnavailable, err)
+	}
+
+	return err
+}
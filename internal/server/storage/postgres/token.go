@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"strings"
+)
+
+type TokenStore struct {
+	db *sql.DB
+}
+
+func NewTokenStore(db *sql.DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+func (s TokenStore) Create(ctx context.Context, t auth.Token) error {
+	return retry(func() error {
+		_, err := s.db.ExecContext(ctx, `INSERT INTO api_tokens ("id", "name", "hash", "scopes", "created_at") VALUES ($1, $2, $3, $4, $5)`,
+			t.ID, t.Name, t.Hash, joinScopes(t.Scopes), t.Created)
+		return err
+	})
+}
+
+func (s TokenStore) Find(ctx context.Context, hash string) (t auth.Token, err error) {
+	var scopes string
+
+	err = retry(func() error {
+		return s.db.QueryRowContext(ctx, `SELECT "id", "name", "hash", "scopes", "created_at" FROM api_tokens WHERE "hash" = $1`, hash).
+			Scan(&t.ID, &t.Name, &t.Hash, &scopes, &t.Created)
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, auth.ErrTokenNotFound
+	}
+
+	if err != nil {
+		return t, err
+	}
+
+	t.Scopes = splitScopes(scopes)
+
+	return t, nil
+}
+
+func (s TokenStore) List(ctx context.Context) (tokens []auth.Token, err error) {
+	var rows *sql.Rows
+
+	err = retry(func() error {
+		rows, err = s.db.QueryContext(ctx, `SELECT "id", "name", "hash", "scopes", "created_at" FROM api_tokens ORDER BY "id"`)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := rows.Close(); r != nil {
+			err = errors.Join(err, r)
+		}
+	}()
+
+	tokens = []auth.Token{}
+
+	for rows.Next() {
+		var (
+			t      auth.Token
+			scopes string
+		)
+
+		if err = rows.Scan(&t.ID, &t.Name, &t.Hash, &scopes, &t.Created); err != nil {
+			return nil, err
+		}
+
+		t.Scopes = splitScopes(scopes)
+
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (s TokenStore) Revoke(ctx context.Context, id string) error {
+	var res sql.Result
+
+	err := retry(func() (err error) {
+		res, err = s.db.ExecContext(ctx, `DELETE FROM api_tokens WHERE "id" = $1`, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return auth.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+func joinScopes(scopes []auth.Scope) string {
+	s := make([]string, len(scopes))
+
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+
+	return strings.Join(s, ",")
+}
+
+func splitScopes(s string) []auth.Scope {
+	var scopes []auth.Scope
+
+	for _, v := range strings.Split(s, ",") {
+		if v != "" {
+			scopes = append(scopes, auth.Scope(v))
+		}
+	}
+
+	return scopes
+}
@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"github.com/baisalov/metricollector/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTokenStore_Conformance(t *testing.T) {
+	db, _ := openStorage(t)
+
+	storagetest.RunTokens(t, func(t *testing.T) storagetest.TokenStore {
+		_, err := db.Exec(`TRUNCATE TABLE api_tokens`)
+		require.NoError(t, err)
+
+		return NewTokenStore(db)
+	})
+}
@@ -0,0 +1,101 @@
+package storagetest
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/idempotency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+type IdempotencyStore interface {
+	Begin(ctx context.Context, key string) (*idempotency.Result, error)
+	Complete(ctx context.Context, key string, res idempotency.Result) error
+	Abort(ctx context.Context, key string) error
+}
+
+// RunIdempotency executes the idempotency store suite. newStore is called
+// once per subtest and must return an empty store.
+func RunIdempotency(t *testing.T, newStore func(t *testing.T) IdempotencyStore) {
+	t.Run("new key", func(t *testing.T) {
+		s := newStore(t)
+
+		res, err := s.Begin(context.Background(), "a")
+		require.NoError(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("in progress", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+
+		_, err = s.Begin(ctx, "a")
+		assert.ErrorIs(t, err, idempotency.ErrInProgress)
+
+		res, err := s.Begin(ctx, "b")
+		require.NoError(t, err)
+		assert.Nil(t, res, "keys are independent")
+	})
+
+	t.Run("completed key is replayed", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+
+		want := idempotency.Result{Status: 200, ContentType: "application/json", Body: []byte(`{"delta":1}`)}
+		require.NoError(t, s.Complete(ctx, "a", want))
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		assert.Equal(t, want, *res)
+	})
+
+	t.Run("aborted key is free", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		_, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, s.Abort(ctx, "a"))
+
+		res, err := s.Begin(ctx, "a")
+		require.NoError(t, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("concurrent begin", func(t *testing.T) {
+		s := newStore(t)
+
+		var (
+			wg    sync.WaitGroup
+			mx    sync.Mutex
+			owned int
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				res, err := s.Begin(context.Background(), "a")
+				if err == nil && res == nil {
+					mx.Lock()
+					owned++
+					mx.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		assert.Equal(t, 1, owned, "only one request owns a key")
+	})
+}
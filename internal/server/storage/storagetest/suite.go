@@ -0,0 +1,320 @@
+// Package storagetest contains a conformance suite that every metric
+// storage backend is expected to pass.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/baisalov/metricollector/internal/metric"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+type Storage interface {
+	Get(ctx context.Context, t metric.Type, id string) (metric.Metric, error)
+	Save(ctx context.Context, m metric.Metric) error
+	Increment(ctx context.Context, id string, delta int64) (metric.Metric, error)
+	All(ctx context.Context) ([]metric.Metric, error)
+	Each(ctx context.Context, fn func(metric.Metric) error) error
+}
+
+type TransactionManager interface {
+	Do(ctx context.Context, fn func(context.Context) error) error
+}
+
+// Backend is a freshly initialised, empty storage under test.
+// Transactions may be nil for backends without transactional support,
+// in which case the rollback checks are skipped.
+type Backend struct {
+	Storage      Storage
+	Transactions TransactionManager
+}
+
+var errRollback = errors.New("rollback")
+
+// Run executes the whole suite. newBackend is called once per subtest
+// and must return an empty backend.
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	t.Run("get not found", func(t *testing.T) {
+		b := newBackend(t)
+
+		_, err := b.Storage.Get(context.Background(), metric.Counter, "unknown")
+
+		assert.ErrorIs(t, err, metric.ErrMetricNotFound)
+	})
+
+	t.Run("save and get", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		counter := metric.NewCounterMetric("counter", 10)
+		gauge := metric.NewGaugeMetric("gauge", 1.5)
+
+		require.NoError(t, b.Storage.Save(ctx, counter))
+		require.NoError(t, b.Storage.Save(ctx, gauge))
+
+		m, err := b.Storage.Get(ctx, metric.Counter, counter.ID)
+		require.NoError(t, err)
+		assert.Equal(t, counter, m)
+
+		m, err = b.Storage.Get(ctx, metric.Gauge, gauge.ID)
+		require.NoError(t, err)
+		assert.Equal(t, gauge, m)
+	})
+
+	t.Run("save overwrites", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		require.NoError(t, b.Storage.Save(ctx, metric.NewGaugeMetric("gauge", 1)))
+		require.NoError(t, b.Storage.Save(ctx, metric.NewGaugeMetric("gauge", 2)))
+
+		m, err := b.Storage.Get(ctx, metric.Gauge, "gauge")
+		require.NoError(t, err)
+		assert.Equal(t, float64(2), *m.Value)
+	})
+
+	t.Run("types are separate namespaces", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		require.NoError(t, b.Storage.Save(ctx, metric.NewCounterMetric("same", 1)))
+
+		_, err := b.Storage.Get(ctx, metric.Gauge, "same")
+		assert.ErrorIs(t, err, metric.ErrMetricNotFound)
+	})
+
+	t.Run("all", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		metrics, err := b.Storage.All(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, metrics)
+
+		want := []metric.Metric{
+			metric.NewCounterMetric("counter", 1),
+			metric.NewGaugeMetric("gauge", 2),
+			metric.NewGaugeMetric("counter", 3),
+		}
+
+		for _, m := range want {
+			require.NoError(t, b.Storage.Save(ctx, m))
+		}
+
+		metrics, err = b.Storage.All(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, want, metrics)
+	})
+
+	t.Run("each", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		want := []metric.Metric{
+			metric.NewCounterMetric("counter", 1),
+			metric.NewGaugeMetric("gauge", 2),
+			metric.NewGaugeMetric("counter", 3),
+		}
+
+		for _, m := range want {
+			require.NoError(t, b.Storage.Save(ctx, m))
+		}
+
+		var metrics []metric.Metric
+
+		require.NoError(t, b.Storage.Each(ctx, func(m metric.Metric) error {
+			metrics = append(metrics, m)
+			return nil
+		}))
+
+		assert.ElementsMatch(t, want, metrics)
+
+		stop := errors.New("stop")
+		calls := 0
+
+		err := b.Storage.Each(ctx, func(metric.Metric) error {
+			calls++
+			return stop
+		})
+
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("concurrent saves", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		const n = 50
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, b.Storage.Save(ctx, metric.NewCounterMetric(fmt.Sprintf("counter_%d", i), int64(i))))
+			}(i)
+		}
+
+		wg.Wait()
+
+		metrics, err := b.Storage.All(ctx)
+		require.NoError(t, err)
+		assert.Len(t, metrics, n)
+	})
+
+	t.Run("increment", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		m, err := b.Storage.Increment(ctx, "counter", 3)
+		require.NoError(t, err)
+		assert.Equal(t, metric.NewCounterMetric("counter", 3), m)
+
+		m, err = b.Storage.Increment(ctx, "counter", 4)
+		require.NoError(t, err)
+		assert.Equal(t, metric.NewCounterMetric("counter", 7), m)
+
+		m, err = b.Storage.Get(ctx, metric.Counter, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), *m.Delta)
+	})
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		b := newBackend(t)
+		ctx := context.Background()
+
+		const n = 50
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := b.Storage.Increment(ctx, "counter", 1)
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+
+		m, err := b.Storage.Get(ctx, metric.Counter, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(n), *m.Delta)
+	})
+
+	t.Run("concurrent increments in transactions", func(t *testing.T) {
+		b := newBackend(t)
+		if b.Transactions == nil {
+			t.Skip("backend has no transaction support")
+		}
+
+		ctx := context.Background()
+
+		const n = 20
+
+		var wg sync.WaitGroup
+
+		// the way the update service applies a batch: no increment of the
+		// same counter may be lost between concurrent transactions
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := b.Transactions.Do(ctx, func(ctx context.Context) error {
+					_, err := b.Storage.Increment(ctx, "counter", 1)
+					return err
+				})
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+
+		m, err := b.Storage.Get(ctx, metric.Counter, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(n), *m.Delta)
+	})
+
+	t.Run("transaction commit", func(t *testing.T) {
+		b := newBackend(t)
+		if b.Transactions == nil {
+			t.Skip("backend has no transaction support")
+		}
+
+		ctx := context.Background()
+
+		err := b.Transactions.Do(ctx, func(ctx context.Context) error {
+			if err := b.Storage.Save(ctx, metric.NewCounterMetric("counter", 5)); err != nil {
+				return err
+			}
+
+			m, err := b.Storage.Get(ctx, metric.Counter, "counter")
+			if err != nil {
+				return err
+			}
+
+			assert.Equal(t, int64(5), *m.Delta)
+
+			m, err = b.Storage.Increment(ctx, "counter", 2)
+			if err != nil {
+				return err
+			}
+
+			assert.Equal(t, int64(7), *m.Delta)
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		m, err := b.Storage.Get(ctx, metric.Counter, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), *m.Delta)
+	})
+
+	t.Run("transaction rollback", func(t *testing.T) {
+		b := newBackend(t)
+		if b.Transactions == nil {
+			t.Skip("backend has no transaction support")
+		}
+
+		ctx := context.Background()
+
+		require.NoError(t, b.Storage.Save(ctx, metric.NewGaugeMetric("gauge", 1)))
+
+		err := b.Transactions.Do(ctx, func(ctx context.Context) error {
+			if err := b.Storage.Save(ctx, metric.NewGaugeMetric("gauge", 2)); err != nil {
+				return err
+			}
+
+			if err := b.Storage.Save(ctx, metric.NewCounterMetric("counter", 1)); err != nil {
+				return err
+			}
+
+			if _, err := b.Storage.Increment(ctx, "counter", 1); err != nil {
+				return err
+			}
+
+			return errRollback
+		})
+		require.ErrorIs(t, err, errRollback)
+
+		m, err := b.Storage.Get(ctx, metric.Gauge, "gauge")
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), *m.Value)
+
+		_, err = b.Storage.Get(ctx, metric.Counter, "counter")
+		assert.ErrorIs(t, err, metric.ErrMetricNotFound)
+	})
+}
@@ -0,0 +1,92 @@
+package storagetest
+
+import (
+	"context"
+	"github.com/baisalov/metricollector/internal/server/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type TokenStore interface {
+	Create(ctx context.Context, t auth.Token) error
+	Find(ctx context.Context, hash string) (auth.Token, error)
+	List(ctx context.Context) ([]auth.Token, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// RunTokens executes the token store suite. newStore is called once per
+// subtest and must return an empty store.
+func RunTokens(t *testing.T, newStore func(t *testing.T) TokenStore) {
+	issue := func(t *testing.T, name string, scopes ...auth.Scope) (auth.Token, string) {
+		token, secret, err := auth.Issue(name, scopes)
+		require.NoError(t, err)
+
+		return token, secret
+	}
+
+	assertToken := func(t *testing.T, want, got auth.Token) {
+		assert.Equal(t, want.ID, got.ID)
+		assert.Equal(t, want.Name, got.Name)
+		assert.Equal(t, want.Scopes, got.Scopes)
+		assert.Equal(t, want.Hash, got.Hash)
+		assert.True(t, want.Created.Equal(got.Created), "created %s, got %s", want.Created, got.Created)
+	}
+
+	t.Run("find by secret hash", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		token, secret := issue(t, "agent", auth.ScopeWrite, auth.ScopeRead)
+
+		require.NoError(t, s.Create(ctx, token))
+
+		got, err := s.Find(ctx, auth.Hash(secret))
+		require.NoError(t, err)
+		assertToken(t, token, got)
+
+		_, err = s.Find(ctx, auth.Hash("unknown"))
+		assert.ErrorIs(t, err, auth.ErrTokenNotFound)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		tokens, err := s.List(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, tokens)
+
+		first, _ := issue(t, "first", auth.ScopeRead)
+		second, _ := issue(t, "second", auth.ScopeAdmin)
+
+		require.NoError(t, s.Create(ctx, first))
+		require.NoError(t, s.Create(ctx, second))
+
+		tokens, err = s.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, tokens, 2)
+
+		if tokens[0].ID != first.ID {
+			tokens[0], tokens[1] = tokens[1], tokens[0]
+		}
+
+		assertToken(t, first, tokens[0])
+		assertToken(t, second, tokens[1])
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		s := newStore(t)
+		ctx := context.Background()
+
+		token, secret := issue(t, "agent", auth.ScopeWrite)
+
+		require.NoError(t, s.Create(ctx, token))
+		require.NoError(t, s.Revoke(ctx, token.ID))
+
+		_, err := s.Find(ctx, auth.Hash(secret))
+		assert.ErrorIs(t, err, auth.ErrTokenNotFound)
+
+		assert.ErrorIs(t, s.Revoke(ctx, token.ID), auth.ErrTokenNotFound)
+	})
+}
@@ -0,0 +1,145 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type pair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// certFile and keyFile hold the PEM encoded pair.
+	certFile string
+	keyFile  string
+}
+
+func issue(t *testing.T, dir, name string, parent *pair, tmpl *x509.Certificate) *pair {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	p := &pair{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+
+	require.NoError(t, os.WriteFile(p.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(p.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	return p
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := issue(t, dir, "ca", nil, &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+
+	server := issue(t, dir, "server", ca, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+
+	client := issue(t, dir, "client", ca, &x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	serverConf, err := Server(server.certFile, server.keyFile, ca.certFile)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = serverConf
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(t *testing.T, caFile, certFile, keyFile string) error {
+		conf, err := Client(caFile, certFile, keyFile)
+		require.NoError(t, err)
+
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+
+		res, err := c.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+		return res.Body.Close()
+	}
+
+	t.Run("with client certificate", func(t *testing.T) {
+		assert.NoError(t, get(t, ca.certFile, client.certFile, client.keyFile))
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		assert.Error(t, get(t, ca.certFile, "", ""))
+	})
+
+	t.Run("untrusted server", func(t *testing.T) {
+		assert.Error(t, get(t, "", client.certFile, client.keyFile))
+	})
+}
+
+func TestClient_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Client("", filepath.Join(dir, "client.crt"), "")
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("nothing"), 0o600))
+
+	_, err = Client(empty, "", "")
+	assert.Error(t, err)
+
+	_, err = Server(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"), "")
+	assert.Error(t, err)
+
+	_, err = Server("", filepath.Join(dir, "server.key"), "")
+	assert.Error(t, err)
+
+	_, err = Server("", "", empty)
+	assert.Error(t, err)
+}